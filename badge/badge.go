@@ -2,29 +2,49 @@ package badge
 
 import (
 	"fmt"
+	"time"
 
-	"github.com/jmoiron/sqlx"
 	"github.com/tsg-ut/tsgctf-checker/checker"
 )
 
 type Badger struct {
-	db *sqlx.DB
+	store  checker.ResultStore
+	uptime UptimeConfig
 }
 
-func NewBadger(db *sqlx.DB) *Badger {
-	return &Badger{db: db}
+func NewBadger(store checker.ResultStore) *Badger {
+	return &Badger{store: store}
 }
 
-func (bd *Badger) GetBadge(chall_name string) (string, error) {
-	results, err := checker.FetchResult(bd.db, chall_name, 1)
+// Set the period of the CTF and the maximum gap between results used to compute uptime.
+func (bd *Badger) SetUptimeConfig(conf UptimeConfig) {
+	bd.uptime = conf
+}
+
+// Fetch the latest result of a challenge as a badge, or `Maintenance` if a window covers it at `now`.
+func (bd *Badger) FetchBadge(chall_name string, now time.Time) (Badge, error) {
+	results, err := bd.store.FetchResult(chall_name, 1)
 	if err != nil {
-		return "", err
+		return Badge{}, err
 	}
 
 	if len(results) != 1 {
-		return "", fmt.Errorf("Status for %s not found.", chall_name)
+		return Badge{}, fmt.Errorf("Status for %s not found.", chall_name)
+	}
+	windows, err := bd.store.FetchMaintenanceWindows(now)
+	if err != nil {
+		return Badge{}, err
 	}
-	result := results[0]
+	status := withMaintenance(newStatus(results[0]), windows, now)
 
-	return GetBadge(result.Name, result.Result, result.Timestamp)
+	return NewBadge(status.Result, status.Timestamp), nil
+}
+
+// Fetch the latest result of a challenge as a shields.io URL.
+func (bd *Badger) GetBadge(chall_name string, now time.Time) (string, error) {
+	badge, err := bd.FetchBadge(chall_name, now)
+	if err != nil {
+		return "", err
+	}
+	return badge.ShieldsUrl(), nil
 }
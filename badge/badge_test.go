@@ -26,9 +26,20 @@ func TestBadge_GetBadge(t *testing.T) {
 			result:     checker.ResultFailure,
 			want:       "https://img.shields.io/badge/Unsolvable-10/15_13:28:33_UTC-CC0000",
 		},
+		{
+			chall_name: "build-fail",
+			result:     checker.ResultBuildFailure,
+			want:       "https://img.shields.io/badge/Build_Failed-10/15_13:28:33_UTC-FF8C00",
+		},
+		{
+			chall_name: "infra-error",
+			result:     checker.ResultInfraError,
+			want:       "https://img.shields.io/badge/Checker_Error-10/15_13:28:33_UTC-808080",
+		},
 	}
 
-	const_time := time.Date(2023, 10, 15, 13, 28, 33, 0, time.UTC)
+	// timestamps in other zones, eg: timestamptz of PostgreSQL, are shown in UTC
+	const_time := time.Date(2023, 10, 15, 22, 28, 33, 0, time.FixedZone("JST", 9*60*60))
 
 	for _, tt := range tests {
 		t.Run(tt.chall_name, func(t *testing.T) {
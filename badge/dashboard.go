@@ -0,0 +1,175 @@
+package badge
+
+// This file implements the HTML status dashboard served by the badge server.
+// The dashboard is rendered on the server and needs no JavaScript.
+
+import (
+	"bytes"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/tsg-ut/tsgctf-checker/checker"
+)
+
+// Number of recent results shown in the sparkline of each challenge.
+const SparklineLength = 30
+
+// Seconds between automatic refreshes of the dashboard.
+const DashboardRefresh = 60
+
+// Genre shown for challenges without genre.
+const noGenre = "misc"
+
+// Results regarded as failures of a test, whose logs are linked from the dashboard.
+var failureResults = []checker.TestResult{
+	checker.ResultFailure,
+	checker.ResultTimeout,
+	checker.ResultExecutionFailure,
+	checker.ResultBuildFailure,
+	checker.ResultInfraError,
+}
+
+// A challenge shown in the dashboard.
+type DashboardChallenge struct {
+	Status
+	LastSuccess *Status
+	LastFailure *Status
+	Recent      []Status // recent results, oldest first
+}
+
+// Challenges of a genre shown in the dashboard.
+type DashboardGenre struct {
+	Name       string
+	Challenges []DashboardChallenge
+}
+
+type Dashboard struct {
+	Genres      []DashboardGenre
+	GeneratedAt time.Time
+	Refresh     int
+}
+
+// Fetch the latest result of a challenge which is one of `results`, or nil if there is none.
+func (bd *Badger) fetchLastStatus(chall_name string, results []checker.TestResult) (*Status, error) {
+	result, err := bd.store.FetchLastResultIn(chall_name, results)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	status := newStatus(result)
+	return &status, nil
+}
+
+// Fetch statuses of all challenges grouped by genre, with maintenance windows at `now` applied.
+func (bd *Badger) FetchDashboard(now time.Time) (Dashboard, error) {
+	latest, err := bd.store.FetchLatestResults()
+	if err != nil {
+		return Dashboard{}, err
+	}
+	windows, err := bd.store.FetchMaintenanceWindows(now)
+	if err != nil {
+		return Dashboard{}, err
+	}
+
+	genres := make(map[string][]DashboardChallenge)
+	for _, result := range latest {
+		chall := DashboardChallenge{Status: withMaintenance(newStatus(result), windows, now)}
+
+		recent, err := bd.store.FetchResult(result.Name, SparklineLength)
+		if err != nil {
+			return Dashboard{}, err
+		}
+		chall.Recent = make([]Status, len(recent))
+		for i, r := range recent {
+			chall.Recent[len(recent)-1-i] = newStatus(r)
+		}
+
+		if chall.LastSuccess, err = bd.fetchLastStatus(result.Name, []checker.TestResult{checker.ResultSuccess}); err != nil {
+			return Dashboard{}, err
+		}
+		if chall.LastFailure, err = bd.fetchLastStatus(result.Name, failureResults); err != nil {
+			return Dashboard{}, err
+		}
+
+		genre := result.Genre
+		if genre == "" {
+			genre = noGenre
+		}
+		genres[genre] = append(genres[genre], chall)
+	}
+
+	dashboard := Dashboard{GeneratedAt: now, Refresh: DashboardRefresh}
+	for name, challs := range genres {
+		dashboard.Genres = append(dashboard.Genres, DashboardGenre{Name: name, Challenges: challs})
+	}
+	sort.Slice(dashboard.Genres, func(i, j int) bool {
+		return dashboard.Genres[i].Name < dashboard.Genres[j].Name
+	})
+	return dashboard, nil
+}
+
+// Human-readable duration from t to now, eg: "3h 12m ago".
+func since(t time.Time, now time.Time) string {
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh %dm ago", int(d.Hours()), int(d.Minutes())%60)
+	default:
+		return fmt.Sprintf("%dd %dh ago", int(d.Hours())/24, int(d.Hours())%24)
+	}
+}
+
+//go:embed dashboard.html
+var dashboardHTML string
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"since": since,
+	"color": func(result checker.TestResult) string { return normalizeColor(result.ToColor()) },
+	"ts":    func(t time.Time) string { return t.UTC().Format("01/02 15:04:05 UTC") },
+}).Parse(dashboardHTML))
+
+// Render the dashboard as HTML.
+func (d Dashboard) Render(w io.Writer) error {
+	var buf bytes.Buffer
+	if err := dashboardTemplate.ExecuteTemplate(&buf, "dashboard", d); err != nil {
+		return err
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// Page showing stdout/stderr of a test run.
+type LogPage struct {
+	checker.DbLog
+}
+
+// Fetch stdout/stderr of a test run of a challenge.
+func (bd *Badger) FetchLogPage(chall_name string, run_id string, attempt uint) (LogPage, error) {
+	log, err := bd.store.FetchLog(chall_name, run_id, attempt)
+	if err != nil {
+		return LogPage{}, err
+	}
+	return LogPage{DbLog: log}, nil
+}
+
+// Render the log page as HTML.
+func (p LogPage) Render(w io.Writer) error {
+	var buf bytes.Buffer
+	if err := dashboardTemplate.ExecuteTemplate(&buf, "log", p); err != nil {
+		return err
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
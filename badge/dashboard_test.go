@@ -0,0 +1,91 @@
+package badge
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tsg-ut/tsgctf-checker/checker"
+)
+
+func TestDashboard_FetchDashboard(t *testing.T) {
+	store := create_store(t)
+	base := time.Date(2023, 10, 15, 13, 28, 33, 0, time.UTC)
+	records := []struct {
+		chall  Challenge
+		result checker.TestResult
+		offset time.Duration
+	}{
+		{Challenge{Name: "pwn1", Genre: "pwn"}, checker.ResultSuccess, 0},
+		{Challenge{Name: "pwn1", Genre: "pwn"}, checker.ResultFailure, time.Minute},
+		{Challenge{Name: "web1", Genre: "web"}, checker.ResultSuccess, time.Minute},
+		{Challenge{Name: "sanity"}, checker.ResultTimeout, time.Minute},
+	}
+	for _, r := range records {
+		res := checker.TestResultMessage{Result: r.result, Timestamp: base.Add(r.offset), Stdout: "<output>"}
+		if err := store.RecordResult(r.chall, res, "run", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := base.Add(2 * time.Hour)
+	dashboard, err := NewBadger(store).FetchDashboard(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dashboard.Genres) != 3 || dashboard.Genres[0].Name != noGenre || dashboard.Genres[1].Name != "pwn" {
+		t.Fatalf("Unexpected genres: %+v", dashboard.Genres)
+	}
+	pwn1 := dashboard.Genres[1].Challenges[0]
+	if pwn1.Result != checker.ResultFailure || len(pwn1.Recent) != 2 || pwn1.Recent[0].Result != checker.ResultSuccess {
+		t.Errorf("Unexpected challenge: %+v", pwn1)
+	}
+	if pwn1.LastSuccess == nil || !pwn1.LastSuccess.Timestamp.Equal(base) {
+		t.Errorf("Unexpected last success: %+v", pwn1.LastSuccess)
+	}
+	if pwn1.LastFailure == nil || pwn1.LastFailure.Result != checker.ResultFailure {
+		t.Errorf("Unexpected last failure: %+v", pwn1.LastFailure)
+	}
+	if dashboard.Genres[0].Challenges[0].LastSuccess != nil {
+		t.Errorf("sanity has never been solvable")
+	}
+
+	var buf bytes.Buffer
+	if err := dashboard.Render(&buf); err != nil {
+		t.Fatal(err)
+	}
+	html := buf.String()
+	for _, want := range []string{"<h2>pwn</h2>", "/dashboard/log/pwn1/run/1", "2h 0m ago", `http-equiv="refresh"`} {
+		if !strings.Contains(html, want) {
+			t.Errorf("%q not found in the dashboard", want)
+		}
+	}
+
+	page, err := NewBadger(store).FetchLogPage("pwn1", "run", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := page.Render(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "&lt;output&gt;") {
+		t.Errorf("Log is not escaped: %s", buf.String())
+	}
+}
+
+func TestDashboard_Since(t *testing.T) {
+	now := time.Date(2023, 10, 15, 13, 28, 33, 0, time.UTC)
+	tests := map[time.Duration]string{
+		10 * time.Second:          "just now",
+		5 * time.Minute:           "5m ago",
+		3*time.Hour + time.Minute: "3h 1m ago",
+		50 * time.Hour:            "2d 2h ago",
+	}
+	for d, want := range tests {
+		if got := since(now.Add(-d), now); got != want {
+			t.Errorf("since(%v) got = %s, want %s", d, got, want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package badge
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tsg-ut/tsgctf-checker/checker"
+)
+
+// Maintenance windows which are not over.
+type MaintenanceList struct {
+	Windows []checker.MaintenanceWindow `json:"windows"`
+}
+
+func (bd *Badger) FetchMaintenance(now time.Time) (MaintenanceList, error) {
+	windows, err := bd.store.FetchMaintenanceWindows(now)
+	if err != nil {
+		return MaintenanceList{}, err
+	}
+	return MaintenanceList{Windows: windows}, nil
+}
+
+// Error of a maintenance window rejected by AddMaintenance.
+var ErrInvalidMaintenance = errors.New("Invalid maintenance window")
+
+// Add a maintenance window, which starts at `now` if its start is not given.
+// The window is picked up by the checker at the beginning of its next test cycle,
+// and shown on badges, the dashboard and the status API immediately.
+func (bd *Badger) AddMaintenance(window checker.MaintenanceWindow, now time.Time) (checker.MaintenanceWindow, error) {
+	if window.Start.IsZero() {
+		window.Start = now
+	}
+	if err := window.Validate(); err != nil {
+		return window, fmt.Errorf("%w: %v", ErrInvalidMaintenance, err)
+	}
+	id, err := bd.store.RecordMaintenanceWindow(window)
+	if err != nil {
+		return window, err
+	}
+	window.ID = id
+	return window, nil
+}
+
+// Delete a maintenance window. sql.ErrNoRows is returned if there is no such window.
+func (bd *Badger) DeleteMaintenance(id int64) error {
+	return bd.store.DeleteMaintenanceWindow(id)
+}
+
+// Status of a challenge shown while a maintenance window covers it at `now`.
+// Windows of the `maintenance_window` table are applied when rendering, since the checker records `Maintenance`
+// only in its next test cycle. Windows of `maintenance_file` are known only to the checker.
+func withMaintenance(status Status, windows []checker.MaintenanceWindow, now time.Time) Status {
+	if status.Result == checker.ResultMaintenance {
+		return status
+	}
+	chall := checker.Challenge{Name: status.Name, Genre: status.Genre}
+	for _, w := range windows {
+		if !w.Covers(chall, now) {
+			continue
+		}
+		maintenance := Status{
+			Name:      status.Name,
+			Genre:     status.Genre,
+			Result:    checker.ResultMaintenance,
+			Status:    checker.ResultMaintenance.ToStatus(),
+			Message:   checker.ResultMaintenance.ToMessage(),
+			Timestamp: status.Timestamp,
+		}
+		// the status changed when the window started
+		if w.Start.After(maintenance.Timestamp) {
+			maintenance.Timestamp = w.Start
+		}
+		return maintenance
+	}
+	return status
+}
@@ -0,0 +1,123 @@
+package badge
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tsg-ut/tsgctf-checker/checker"
+)
+
+func TestMaintenance_AddMaintenance(t *testing.T) {
+	badger := NewBadger(create_store(t))
+	now := time.Date(2023, 11, 4, 10, 0, 0, 0, time.UTC)
+
+	window, err := badger.AddMaintenance(checker.MaintenanceWindow{Challenge: "pwn", End: now.Add(time.Hour), Reason: "redeploy"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if window.ID == 0 || !window.Start.Equal(now) {
+		t.Errorf("Window should start now and have its ID: %+v", window)
+	}
+	if _, err := badger.AddMaintenance(checker.MaintenanceWindow{End: now.Add(time.Hour)}, now); !errors.Is(err, ErrInvalidMaintenance) {
+		t.Errorf("Expected ErrInvalidMaintenance for a window without challenge and genre, got %v", err)
+	}
+
+	list, err := badger.FetchMaintenance(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Windows) != 1 || list.Windows[0].ID != window.ID || list.Windows[0].Reason != "redeploy" {
+		t.Errorf("Unexpected windows: %+v", list)
+	}
+	if list, err := badger.FetchMaintenance(now.Add(time.Hour)); err != nil || len(list.Windows) != 0 {
+		t.Errorf("Expected no windows after the end, got %+v, %v", list, err)
+	}
+
+	if err := badger.DeleteMaintenance(window.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := badger.DeleteMaintenance(window.ID); err != sql.ErrNoRows {
+		t.Errorf("DeleteMaintenance() error = %v, want %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestMaintenance_Badge(t *testing.T) {
+	store := create_store(t)
+	base := time.Date(2023, 10, 15, 12, 0, 0, 0, time.UTC)
+	for i, result := range []checker.TestResult{checker.ResultSuccess, checker.ResultMaintenance, checker.ResultMaintenance, checker.ResultFailure} {
+		res := checker.TestResultMessage{Result: result, Timestamp: base.Add(time.Duration(i) * 15 * time.Minute)}
+		if err := store.RecordResult(Challenge{Name: "pwn"}, res, "run", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	badger := NewBadger(store)
+	badger.SetUptimeConfig(UptimeConfig{MaxGap: 15 * time.Minute})
+
+	// maintenance is excluded from uptime
+	uptime, err := badger.FetchUptime("pwn", "1h", base.Add(time.Hour), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uptime.MaintenanceSeconds != 30*60 || uptime.Uptime == nil || *uptime.Uptime != 0.5 {
+		t.Errorf("Unexpected uptime: %+v", uptime)
+	}
+
+	b := NewBadge(checker.ResultMaintenance, base)
+	if b.Label != "Maintenance" || b.Color != "1E90FF" {
+		t.Errorf("Unexpected badge: %+v", b)
+	}
+}
+
+func TestMaintenance_ActiveWindow(t *testing.T) {
+	store := create_store(t)
+	base := time.Date(2023, 11, 4, 10, 0, 0, 0, time.UTC)
+	for _, chall := range []Challenge{{Name: "pwn1", Genre: "pwn"}, {Name: "web1", Genre: "web"}} {
+		res := checker.TestResultMessage{Result: checker.ResultFailure, Timestamp: base}
+		if err := store.RecordResult(chall, res, "run", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	badger := NewBadger(store)
+	start := base.Add(time.Minute)
+	if _, err := badger.AddMaintenance(checker.MaintenanceWindow{Genre: "pwn", Start: start, End: start.Add(time.Hour)}, start); err != nil {
+		t.Fatal(err)
+	}
+
+	// the window is shown before the checker records Maintenance
+	now := start.Add(time.Minute)
+	b, err := badger.FetchBadge("pwn1", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Label != "Maintenance" {
+		t.Errorf("Badge should be under maintenance: %+v", b)
+	}
+	list, err := badger.FetchStatusList(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pwn1 := list.Challenges[0]; pwn1.Result != checker.ResultMaintenance || !pwn1.Timestamp.Equal(start) {
+		t.Errorf("Unexpected status of pwn1: %+v", pwn1)
+	}
+	if web1 := list.Challenges[1]; web1.Result != checker.ResultFailure {
+		t.Errorf("web1 is not covered by the window: %+v", web1)
+	}
+	dashboard, err := badger.FetchDashboard(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pwn1 := dashboard.Genres[0].Challenges[0]; pwn1.Result != checker.ResultMaintenance || pwn1.LastFailure == nil {
+		t.Errorf("Unexpected challenge in dashboard: %+v", pwn1)
+	}
+
+	// the latest result is shown again after the window
+	b, err = badger.FetchBadge("pwn1", start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Label == "Maintenance" {
+		t.Errorf("Badge should not be under maintenance after the window: %+v", b)
+	}
+}
@@ -8,6 +8,13 @@ import (
 	"github.com/tsg-ut/tsgctf-checker/checker"
 )
 
+// Label, message and color of a badge, in the same semantics as shields.io.
+type Badge struct {
+	Label   string
+	Message string
+	Color   string // hex code without "#" or named color of shields.io
+}
+
 func toShieldsString(s string) string {
 	s = strings.ReplaceAll(s, "-", "--")
 	s = strings.ReplaceAll(s, "_", "__")
@@ -24,11 +31,19 @@ func toShieldsUrl(label string, message string, color string) string {
 	return fmt.Sprintf("https://img.shields.io/badge/%s", value)
 }
 
-func GetBadge(chall_name string, result checker.TestResult, timestamp time.Time) (string, error) {
-	label := result.ToMessage()
-	message := fmt.Sprintf("%s", timestamp.Format("01/02 15:04:05 UTC"))
-	color := result.ToColor()
-	url := toShieldsUrl(label, message, color)
+// Create a badge of a test result.
+func NewBadge(result checker.TestResult, timestamp time.Time) Badge {
+	return Badge{
+		Label:   result.ToMessage(),
+		Message: timestamp.UTC().Format("01/02 15:04:05 UTC"),
+		Color:   result.ToColor(),
+	}
+}
 
-	return url, nil
+func (b Badge) ShieldsUrl() string {
+	return toShieldsUrl(b.Label, b.Message, b.Color)
+}
+
+func GetBadge(chall_name string, result checker.TestResult, timestamp time.Time) (string, error) {
+	return NewBadge(result, timestamp).ShieldsUrl(), nil
 }
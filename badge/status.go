@@ -0,0 +1,134 @@
+package badge
+
+// This file implements the status of challenges served as JSON by the badge server.
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tsg-ut/tsgctf-checker/checker"
+)
+
+// Default and maximum number of results in a page of the history.
+const (
+	DefaultPerPage = 50
+	MaxPerPage     = 500
+)
+
+// A test result of a challenge.
+type Status struct {
+	Name    string             `json:"name"`
+	Genre   string             `json:"genre"`
+	Result  checker.TestResult `json:"result"`
+	Status  string             `json:"status"`  // machine-readable name of Result
+	Message string             `json:"message"` // message shown on the badge
+	// timestamp when the result is recorded
+	Timestamp time.Time `json:"timestamp"`
+	Attempt   uint      `json:"attempt"`
+	// ID of the test cycle, which is the key of logs. It is not served by the public API.
+	RunID string `json:"-"`
+	// seconds taken to build and run the solver
+	Duration      float64 `json:"duration"`
+	BuildDuration float64 `json:"build_duration"`
+	RunDuration   float64 `json:"run_duration"`
+	ExitCode      int     `json:"exit_code"`
+}
+
+// Latest statuses of all challenges.
+type StatusList struct {
+	Challenges []Status `json:"challenges"`
+}
+
+// A page of the history of a challenge, newest first.
+type History struct {
+	Name    string   `json:"name"`
+	Page    int      `json:"page"` // 1-origin
+	PerPage int      `json:"per_page"`
+	HasNext bool     `json:"has_next"`
+	Results []Status `json:"results"`
+}
+
+func newStatus(result checker.DbResult) Status {
+	return Status{
+		Name:          result.Name,
+		Genre:         result.Genre,
+		Result:        result.Result,
+		Status:        result.Result.ToStatus(),
+		Message:       result.Result.ToMessage(),
+		Timestamp:     result.Timestamp,
+		Attempt:       result.Attempt,
+		RunID:         result.RunID,
+		Duration:      result.BuildDuration + result.RunDuration,
+		BuildDuration: result.BuildDuration,
+		RunDuration:   result.RunDuration,
+		ExitCode:      result.ExitCode,
+	}
+}
+
+// Latest timestamp of the statuses, used as Last-Modified.
+func lastModified(statuses []Status) time.Time {
+	var last time.Time
+	for _, s := range statuses {
+		if s.Timestamp.After(last) {
+			last = s.Timestamp
+		}
+	}
+	return last
+}
+
+func (l StatusList) LastModified() time.Time {
+	return lastModified(l.Challenges)
+}
+
+func (h History) LastModified() time.Time {
+	return lastModified(h.Results)
+}
+
+// Fetch the latest statuses of all challenges recorded, with maintenance windows at `now` applied.
+func (bd *Badger) FetchStatusList(now time.Time) (StatusList, error) {
+	results, err := bd.store.FetchLatestResults()
+	if err != nil {
+		return StatusList{}, err
+	}
+	windows, err := bd.store.FetchMaintenanceWindows(now)
+	if err != nil {
+		return StatusList{}, err
+	}
+
+	list := StatusList{Challenges: make([]Status, 0, len(results))}
+	for _, result := range results {
+		list.Challenges = append(list.Challenges, withMaintenance(newStatus(result), windows, now))
+	}
+	return list, nil
+}
+
+// Fetch a page (1-origin) of the history of a challenge.
+func (bd *Badger) FetchHistory(chall_name string, page int, per_page int) (History, error) {
+	if page < 1 {
+		return History{}, fmt.Errorf("Invalid page: %d", page)
+	}
+	if per_page < 1 || per_page > MaxPerPage {
+		return History{}, fmt.Errorf("Invalid per_page: %d (must be in [1, %d])", per_page, MaxPerPage)
+	}
+
+	// fetch one more result to know whether the next page exists
+	results, err := bd.store.FetchResultPage(chall_name, (page-1)*per_page, per_page+1)
+	if err != nil {
+		return History{}, err
+	}
+
+	history := History{
+		Name:    chall_name,
+		Page:    page,
+		PerPage: per_page,
+		HasNext: len(results) > per_page,
+		Results: make([]Status, 0, per_page),
+	}
+	for i, result := range results {
+		if i == per_page {
+			break
+		}
+		history.Results = append(history.Results, newStatus(result))
+	}
+	return history, nil
+}
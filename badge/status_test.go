@@ -0,0 +1,107 @@
+package badge
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tsg-ut/tsgctf-checker/checker"
+	"go.uber.org/zap"
+)
+
+func create_store(t *testing.T) *checker.SQLStore {
+	t.Helper()
+	db, err := checker.ConnectSQLite(filepath.Join(t.TempDir(), "checker.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := checker.NewSQLStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if err := store.Migrate(zap.NewNop().Sugar()); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestStatus_FetchStatusList(t *testing.T) {
+	store := create_store(t)
+	base := time.Date(2023, 10, 15, 13, 28, 33, 0, time.UTC)
+	records := []struct {
+		name   string
+		result checker.TestResult
+		offset time.Duration
+	}{
+		{"pwn", checker.ResultFailure, 0},
+		{"pwn", checker.ResultSuccess, time.Minute},
+		{"web", checker.ResultTimeout, 30 * time.Second},
+	}
+	for _, r := range records {
+		res := checker.TestResultMessage{Result: r.result, Timestamp: base.Add(r.offset), BuildTime: time.Second, RunTime: 2 * time.Second}
+		if err := store.RecordResult(Challenge{Name: r.name}, res, "run", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := NewBadger(store).FetchStatusList(base.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Challenges) != 2 {
+		t.Fatalf("Expected 2 challenges, got %+v", list.Challenges)
+	}
+	pwn := list.Challenges[0]
+	if pwn.Name != "pwn" || pwn.Status != "success" || pwn.Duration != 3 {
+		t.Errorf("Unexpected status of pwn: %+v", pwn)
+	}
+	if !list.LastModified().Equal(base.Add(time.Minute)) {
+		t.Errorf("Unexpected last modified: %v", list.LastModified())
+	}
+
+	// run IDs, which are the keys of logs, are not public
+	body, err := json.Marshal(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(body), "run_id") || strings.Contains(string(body), `"run"`) {
+		t.Errorf("Run ID must not be served: %s", body)
+	}
+}
+
+func TestStatus_FetchHistory(t *testing.T) {
+	store := create_store(t)
+	base := time.Date(2023, 10, 15, 13, 28, 33, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		res := checker.TestResultMessage{Result: checker.ResultSuccess, Timestamp: base.Add(time.Duration(i) * time.Minute)}
+		if err := store.RecordResult(Challenge{Name: "pwn"}, res, "run", uint(i+1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	badger := NewBadger(store)
+
+	first, err := badger.FetchHistory("pwn", 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Results) != 2 || !first.HasNext || first.Results[0].Attempt != 5 {
+		t.Errorf("Unexpected first page: %+v", first)
+	}
+	last, err := badger.FetchHistory("pwn", 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(last.Results) != 1 || last.HasNext || last.Results[0].Attempt != 1 {
+		t.Errorf("Unexpected last page: %+v", last)
+	}
+
+	if _, err := badger.FetchHistory("pwn", 0, 2); err == nil {
+		t.Errorf("Expected error for page 0")
+	}
+	if _, err := badger.FetchHistory("pwn", 1, MaxPerPage+1); err == nil {
+		t.Errorf("Expected error for too large per_page")
+	}
+}
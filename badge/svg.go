@@ -0,0 +1,196 @@
+package badge
+
+// This file renders badges as SVG locally, in the same looks as shields.io,
+// so that badges are available even when shields.io is slow or blocked.
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"math"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Style of SVG badges, compatible with `style` parameter of shields.io.
+type Style string
+
+const (
+	StyleFlat       Style = "flat"
+	StyleFlatSquare Style = "flat-square"
+)
+
+func ParseStyle(s string) (Style, error) {
+	switch Style(s) {
+	case "", StyleFlat:
+		return StyleFlat, nil
+	case StyleFlatSquare:
+		return StyleFlatSquare, nil
+	default:
+		return "", fmt.Errorf("Unknown badge style: %s", s)
+	}
+}
+
+// Named colors of shields.io.
+var namedColors = map[string]string{
+	"brightgreen":   "4c1",
+	"green":         "97ca00",
+	"yellow":        "dfb317",
+	"yellowgreen":   "a4a61d",
+	"orange":        "fe7d37",
+	"red":           "e05d44",
+	"blue":          "007ec6",
+	"grey":          "555",
+	"gray":          "555",
+	"lightgrey":     "9f9f9f",
+	"lightgray":     "9f9f9f",
+	"success":       "4c1",
+	"important":     "fe7d37",
+	"critical":      "e05d44",
+	"informational": "007ec6",
+	"inactive":      "9f9f9f",
+}
+
+// Width in pixels of ASCII characters from ' ' to '~' in 11px Verdana, which shields.io uses.
+var verdanaWidths = [...]float64{
+	3.87, 4.33, 5.05, 9.00, 7.00, 11.84, 7.99, 2.95, 4.99, 4.99, 7.00, 9.00, 4.00, 4.99, 4.00, 4.99, // ' ' - '/'
+	7.00, 7.00, 7.00, 7.00, 7.00, 7.00, 7.00, 7.00, 7.00, 7.00, 4.99, 4.99, 9.00, 9.00, 9.00, 6.00, // '0' - '?'
+	11.0, 7.52, 7.54, 7.68, 8.48, 6.96, 6.32, 8.53, 8.27, 4.63, 5.00, 7.62, 6.12, 9.27, 8.23, 8.66, // '@' - 'O'
+	6.63, 8.66, 7.65, 7.52, 6.78, 8.05, 7.52, 10.87, 7.54, 6.77, 7.54, 4.99, 4.99, 4.99, 9.00, 7.00, // 'P' - '_'
+	7.00, 6.61, 6.85, 5.73, 6.85, 6.55, 3.87, 6.85, 6.96, 3.02, 3.79, 6.51, 3.02, 10.7, 6.96, 6.68, // '`' - 'o'
+	6.85, 6.85, 4.69, 5.73, 4.33, 6.96, 6.51, 9.00, 6.51, 6.51, 5.78, 6.98, 4.99, 6.98, 9.00, // 'p' - '~'
+}
+
+// Width of characters not in verdanaWidths, which is the width of 'm'.
+const defaultCharWidth = 10.7
+
+// Horizontal padding in pixels on each side of texts.
+const textPadding = 5
+
+// Approximate width in pixels of a text rendered in 11px Verdana.
+func textWidth(s string) float64 {
+	width := 0.0
+	for _, c := range s {
+		if c >= ' ' && int(c-' ') < len(verdanaWidths) {
+			width += verdanaWidths[c-' ']
+		} else {
+			width += defaultCharWidth
+		}
+	}
+	return width
+}
+
+// Normalize a color of shields.io into "#rrggbb" form.
+// Unknown colors fall back to lightgrey like shields.io.
+func normalizeColor(color string) string {
+	hex := strings.ToLower(strings.TrimPrefix(color, "#"))
+	if named, ok := namedColors[hex]; ok {
+		hex = named
+	}
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return "#" + namedColors["lightgrey"]
+	}
+	if _, err := strconv.ParseUint(hex, 16, 32); err != nil {
+		return "#" + namedColors["lightgrey"]
+	}
+	return "#" + hex
+}
+
+// Check if dark text should be used on the background color, in the same way as shields.io.
+func isBright(color string) bool {
+	rgb, _ := strconv.ParseUint(strings.TrimPrefix(color, "#"), 16, 32)
+	r := float64((rgb >> 16) & 0xff)
+	g := float64((rgb >> 8) & 0xff)
+	b := float64(rgb & 0xff)
+	return (r*299+g*587+b*114)/255000 > 0.69
+}
+
+type svgText struct {
+	Text        string
+	X           int // center of the text, in 1/10 px
+	Length      int // length of the text, in 1/10 px
+	Color       string
+	ShadowColor string
+}
+
+type svgBadge struct {
+	Title        string
+	Width        int
+	LabelWidth   int
+	MessageWidth int
+	Color        string
+	Label        svgText
+	Message      svgText
+}
+
+var flatTemplate = template.Must(template.New("flat").Parse(
+	`<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="20" role="img" aria-label="{{.Title}}">` +
+		`<title>{{.Title}}</title>` +
+		`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>` +
+		`<clipPath id="r"><rect width="{{.Width}}" height="20" rx="3" fill="#fff"/></clipPath>` +
+		`<g clip-path="url(#r)"><rect width="{{.LabelWidth}}" height="20" fill="#555"/><rect x="{{.LabelWidth}}" width="{{.MessageWidth}}" height="20" fill="{{.Color}}"/><rect width="{{.Width}}" height="20" fill="url(#s)"/></g>` +
+		`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" text-rendering="geometricPrecision" font-size="110">` +
+		`{{with .Label}}<text aria-hidden="true" x="{{.X}}" y="150" fill="{{.ShadowColor}}" fill-opacity=".3" transform="scale(.1)" textLength="{{.Length}}">{{.Text}}</text><text x="{{.X}}" y="140" transform="scale(.1)" fill="{{.Color}}" textLength="{{.Length}}">{{.Text}}</text>{{end}}` +
+		`{{with .Message}}<text aria-hidden="true" x="{{.X}}" y="150" fill="{{.ShadowColor}}" fill-opacity=".3" transform="scale(.1)" textLength="{{.Length}}">{{.Text}}</text><text x="{{.X}}" y="140" transform="scale(.1)" fill="{{.Color}}" textLength="{{.Length}}">{{.Text}}</text>{{end}}` +
+		`</g></svg>`))
+
+var flatSquareTemplate = template.Must(template.New("flat-square").Parse(
+	`<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="20" role="img" aria-label="{{.Title}}">` +
+		`<title>{{.Title}}</title>` +
+		`<g shape-rendering="crispEdges"><rect width="{{.LabelWidth}}" height="20" fill="#555"/><rect x="{{.LabelWidth}}" width="{{.MessageWidth}}" height="20" fill="{{.Color}}"/></g>` +
+		`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" text-rendering="geometricPrecision" font-size="110">` +
+		`{{with .Label}}<text x="{{.X}}" y="140" transform="scale(.1)" fill="{{.Color}}" textLength="{{.Length}}">{{.Text}}</text>{{end}}` +
+		`{{with .Message}}<text x="{{.X}}" y="140" transform="scale(.1)" fill="{{.Color}}" textLength="{{.Length}}">{{.Text}}</text>{{end}}` +
+		`</g></svg>`))
+
+func newSvgText(text string, offset int, color string) (svgText, int) {
+	text_width := textWidth(text)
+	width := int(math.Round(text_width)) + 2*textPadding
+	t := svgText{
+		Text:        html.EscapeString(text),
+		X:           int(math.Round((float64(offset) + float64(width)/2) * 10)),
+		Length:      int(math.Round(text_width * 10)),
+		Color:       "#fff",
+		ShadowColor: "#010101",
+	}
+	if isBright(color) {
+		t.Color = "#333"
+		t.ShadowColor = "#ccc"
+	}
+	return t, width
+}
+
+// Render the badge as SVG in the given style.
+func (b Badge) SVG(style Style) ([]byte, error) {
+	tmpl := flatTemplate
+	switch style {
+	case "", StyleFlat:
+	case StyleFlatSquare:
+		tmpl = flatSquareTemplate
+	default:
+		return nil, fmt.Errorf("Unknown badge style: %s", style)
+	}
+
+	color := normalizeColor(b.Color)
+	label, label_width := newSvgText(b.Label, 0, "#555")
+	message, message_width := newSvgText(b.Message, label_width, color)
+	data := svgBadge{
+		Title:        html.EscapeString(fmt.Sprintf("%s: %s", b.Label, b.Message)),
+		Width:        label_width + message_width,
+		LabelWidth:   label_width,
+		MessageWidth: message_width,
+		Color:        color,
+		Label:        label,
+		Message:      message,
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,79 @@
+package badge
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tsg-ut/tsgctf-checker/checker"
+)
+
+func TestSvg_NormalizeColor(t *testing.T) {
+	tests := map[string]string{
+		"33FF99":  "#33ff99",
+		"#CC0000": "#cc0000",
+		"green":   "#97ca00",
+		"4c1":     "#44cc11",
+		"unknown": "#9f9f9f",
+		"GGGGGG":  "#9f9f9f",
+	}
+	for color, want := range tests {
+		if got := normalizeColor(color); got != want {
+			t.Errorf("normalizeColor(%s) got = %s, want %s", color, got, want)
+		}
+	}
+}
+
+func TestSvg_SVG(t *testing.T) {
+	const_time := time.Date(2023, 10, 15, 13, 28, 33, 0, time.UTC)
+	badge := NewBadge(checker.ResultSuccess, const_time)
+
+	for _, style := range []Style{StyleFlat, StyleFlatSquare} {
+		t.Run(string(style), func(t *testing.T) {
+			svg, err := badge.SVG(style)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var parsed struct {
+				XMLName xml.Name `xml:"svg"`
+				Width   int      `xml:"width,attr"`
+				Title   string   `xml:"title"`
+			}
+			if err := xml.Unmarshal(svg, &parsed); err != nil {
+				t.Fatalf("Invalid SVG: %v", err)
+			}
+			if parsed.Title != "Solvable: 10/15 13:28:33 UTC" {
+				t.Errorf("Unexpected title: %s", parsed.Title)
+			}
+			if parsed.Width < 100 {
+				t.Errorf("Badge is too narrow: %d", parsed.Width)
+			}
+			if !strings.Contains(string(svg), `fill="#33ff99"`) {
+				t.Errorf("Color of the result not found in %s", svg)
+			}
+			// dark text on the bright background
+			if !strings.Contains(string(svg), `fill="#333"`) {
+				t.Errorf("Dark text not found in %s", svg)
+			}
+		})
+	}
+
+	if _, err := badge.SVG("plastic"); err == nil {
+		t.Errorf("Expected error for unknown style")
+	}
+}
+
+func TestSvg_Escape(t *testing.T) {
+	svg, err := Badge{Label: "<script>", Message: "a&b", Color: "red"}.SVG(StyleFlat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(svg), "<script>") {
+		t.Errorf("Label is not escaped: %s", svg)
+	}
+	if err := xml.Unmarshal(svg, new(struct{})); err != nil {
+		t.Errorf("Invalid SVG: %v", err)
+	}
+}
@@ -0,0 +1,232 @@
+package badge
+
+// This file computes uptime of challenges from the history of test results.
+// A result is regarded as the state of the challenge until the next result,
+// but at most for MaxGap, so that periods when the checker itself was not running
+// are counted as unknown instead of the last state.
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsg-ut/tsgctf-checker/checker"
+)
+
+// Default maximum duration for which a result is regarded as the state of the challenge.
+const DefaultMaxGap = 3 * checker.DefaultInterval * time.Second
+
+// States of a challenge in the timeline.
+const (
+	StateSolvable   = "solvable"
+	StateUnsolvable = "unsolvable"
+	// the checker was not running or could not test the challenge
+	StateUnknown = "unknown"
+	// the challenge was under maintenance
+	StateMaintenance = "maintenance"
+)
+
+// Windows computed when no window is specified.
+var DefaultWindows = []string{"1h", "24h", "ctf"}
+
+type UptimeConfig struct {
+	// period of the CTF used by the "ctf" window. If CTFStart is zero, the first result is used.
+	CTFStart time.Time
+	CTFEnd   time.Time
+	// maximum duration for which a result is regarded as the state of the challenge
+	MaxGap time.Duration
+}
+
+// A period in which the state of a challenge is the same.
+type Interval struct {
+	From  time.Time `json:"from"`
+	To    time.Time `json:"to"`
+	State string    `json:"state"`
+}
+
+// Uptime of a challenge in a window.
+type Uptime struct {
+	Name   string    `json:"name"`
+	Window string    `json:"window"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	// fraction of solvable time in the time when the state is known. nil if the state is never known.
+	// maintenance is excluded as well as unknown time.
+	Uptime             *float64 `json:"uptime"`
+	SolvableSeconds    float64  `json:"solvable_seconds"`
+	UnsolvableSeconds  float64  `json:"unsolvable_seconds"`
+	UnknownSeconds     float64  `json:"unknown_seconds"`
+	MaintenanceSeconds float64  `json:"maintenance_seconds"`
+	// only set when the timeline is requested
+	Timeline []Interval `json:"timeline,omitempty"`
+}
+
+// State of a challenge indicated by a test result.
+func resultState(result checker.TestResult) string {
+	switch result {
+	case checker.ResultSuccess:
+		return StateSolvable
+	case checker.ResultInfraError, checker.ResultTestInterrupted, checker.ResultRunning:
+		// the challenge was not actually tested
+		return StateUnknown
+	case checker.ResultMaintenance:
+		return StateMaintenance
+	default:
+		return StateUnsolvable
+	}
+}
+
+// Split [from, to) into intervals of states by test results sorted oldest first.
+// Results before `from` are used to know the state at `from`.
+func timeline(results []checker.DbResult, from time.Time, to time.Time, max_gap time.Duration) []Interval {
+	intervals := make([]Interval, 0)
+	add := func(start time.Time, end time.Time, state string) {
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if !start.Before(end) {
+			return
+		}
+		if n := len(intervals); n > 0 && intervals[n-1].State == state && intervals[n-1].To.Equal(start) {
+			intervals[n-1].To = end
+			return
+		}
+		intervals = append(intervals, Interval{From: start, To: end, State: state})
+	}
+
+	cursor := from
+	for i, result := range results {
+		end := result.Timestamp.Add(max_gap)
+		if i+1 < len(results) && results[i+1].Timestamp.Before(end) {
+			end = results[i+1].Timestamp
+		}
+		if result.Timestamp.After(cursor) {
+			add(cursor, result.Timestamp, StateUnknown)
+		}
+		add(result.Timestamp, end, resultState(result.Result))
+		if end.After(cursor) {
+			cursor = end
+		}
+	}
+	add(cursor, to, StateUnknown)
+	return intervals
+}
+
+// Parse a window such as "1h", "24h", "7d" or "ctf".
+func ParseWindow(window string) (time.Duration, error) {
+	if window == "ctf" {
+		return 0, nil
+	}
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(window, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(window)
+	}
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("Invalid window: %s", window)
+	}
+	return d, nil
+}
+
+// Compute uptime of a challenge in a window until now.
+// With `with_timeline`, the intervals of states are also returned.
+func (bd *Badger) FetchUptime(chall_name string, window string, now time.Time, with_timeline bool) (Uptime, error) {
+	d, err := ParseWindow(window)
+	if err != nil {
+		return Uptime{}, err
+	}
+	max_gap := bd.uptime.MaxGap
+	if max_gap <= 0 {
+		max_gap = DefaultMaxGap
+	}
+
+	to := now
+	var from time.Time
+	if d == 0 {
+		if !bd.uptime.CTFEnd.IsZero() && bd.uptime.CTFEnd.Before(to) {
+			to = bd.uptime.CTFEnd
+		}
+		from = bd.uptime.CTFStart
+	} else {
+		from = to.Add(-d)
+	}
+
+	// results before the window tell the state at its beginning
+	var query_from time.Time
+	if !from.IsZero() {
+		query_from = from.Add(-max_gap)
+	}
+	results, err := bd.store.FetchResultRange(chall_name, query_from, to)
+	if err != nil {
+		return Uptime{}, err
+	}
+	// the "ctf" window without CTFStart starts with the first result, and is empty if there is none
+	if from.IsZero() {
+		from = to
+		if len(results) > 0 {
+			from = results[0].Timestamp
+		}
+	}
+
+	uptime := Uptime{Name: chall_name, Window: window, From: from, To: to}
+	intervals := timeline(results, from, to, max_gap)
+	for _, interval := range intervals {
+		seconds := interval.To.Sub(interval.From).Seconds()
+		switch interval.State {
+		case StateSolvable:
+			uptime.SolvableSeconds += seconds
+		case StateUnsolvable:
+			uptime.UnsolvableSeconds += seconds
+		case StateMaintenance:
+			uptime.MaintenanceSeconds += seconds
+		default:
+			uptime.UnknownSeconds += seconds
+		}
+	}
+	if known := uptime.SolvableSeconds + uptime.UnsolvableSeconds; known > 0 {
+		fraction := uptime.SolvableSeconds / known
+		uptime.Uptime = &fraction
+	}
+	if with_timeline {
+		uptime.Timeline = intervals
+	}
+	return uptime, nil
+}
+
+// Color of an uptime badge by thresholds.
+func uptimeColor(uptime float64) string {
+	switch {
+	case uptime >= 0.99:
+		return "brightgreen"
+	case uptime >= 0.95:
+		return "green"
+	case uptime >= 0.90:
+		return "yellowgreen"
+	case uptime >= 0.80:
+		return "yellow"
+	case uptime >= 0.50:
+		return "orange"
+	default:
+		return "red"
+	}
+}
+
+// Badge of the uptime, eg: "uptime (24h) | 99.2% solvable".
+func (u Uptime) Badge() Badge {
+	label := fmt.Sprintf("uptime (%s)", u.Window)
+	if u.Uptime == nil {
+		return Badge{Label: label, Message: "no data", Color: "lightgrey"}
+	}
+	// round down so that 100% means no failure at all
+	percent := math.Floor(*u.Uptime*1000) / 10
+	return Badge{Label: label, Message: fmt.Sprintf("%.1f%% solvable", percent), Color: uptimeColor(*u.Uptime)}
+}
@@ -0,0 +1,94 @@
+package badge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tsg-ut/tsgctf-checker/checker"
+)
+
+func TestUptime_Timeline(t *testing.T) {
+	base := time.Date(2023, 10, 15, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+	results := []checker.DbResult{
+		{Result: checker.ResultSuccess, Timestamp: at(-5)},
+		{Result: checker.ResultFailure, Timestamp: at(10)},
+		{Result: checker.ResultSuccess, Timestamp: at(15)},
+		// the checker stopped for a while after this result
+		{Result: checker.ResultSuccess, Timestamp: at(20)},
+		{Result: checker.ResultInfraError, Timestamp: at(50)},
+		{Result: checker.ResultSuccess, Timestamp: at(55)},
+	}
+
+	got := timeline(results, at(0), at(60), 15*time.Minute)
+	want := []Interval{
+		{From: at(0), To: at(10), State: StateSolvable},
+		{From: at(10), To: at(15), State: StateUnsolvable},
+		{From: at(15), To: at(35), State: StateSolvable},
+		{From: at(35), To: at(55), State: StateUnknown},
+		{From: at(55), To: at(60), State: StateSolvable},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("timeline() got = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if !got[i].From.Equal(want[i].From) || !got[i].To.Equal(want[i].To) || got[i].State != want[i].State {
+			t.Errorf("timeline()[%d] got = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestUptime_FetchUptime(t *testing.T) {
+	store := create_store(t)
+	base := time.Date(2023, 10, 15, 12, 0, 0, 0, time.UTC)
+	for i, result := range []checker.TestResult{checker.ResultSuccess, checker.ResultFailure, checker.ResultSuccess, checker.ResultSuccess} {
+		res := checker.TestResultMessage{Result: result, Timestamp: base.Add(time.Duration(i) * 15 * time.Minute)}
+		if err := store.RecordResult(Challenge{Name: "pwn"}, res, "run", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	badger := NewBadger(store)
+	badger.SetUptimeConfig(UptimeConfig{MaxGap: 15 * time.Minute})
+	now := base.Add(time.Hour)
+
+	uptime, err := badger.FetchUptime("pwn", "1h", now, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uptime.Uptime == nil || *uptime.Uptime != 0.75 || uptime.UnknownSeconds != 0 {
+		t.Errorf("Unexpected uptime: %+v", uptime)
+	}
+	if b := uptime.Badge(); b.Message != "75.0% solvable" || b.Color != "orange" {
+		t.Errorf("Unexpected badge: %+v", b)
+	}
+
+	// the whole CTF starts with the first result if not configured
+	ctf, err := badger.FetchUptime("pwn", "ctf", now.Add(time.Hour), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ctf.From.Equal(base) || ctf.UnknownSeconds != 60*60 || *ctf.Uptime != 0.75 {
+		t.Errorf("Unexpected uptime of the CTF: %+v", ctf)
+	}
+
+	none, err := badger.FetchUptime("unknown", "24h", now, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if none.Uptime != nil || none.Badge().Message != "no data" {
+		t.Errorf("Expected no data, got %+v", none)
+	}
+
+	// without CTFStart nor results, the window is empty instead of starting at the zero time
+	none, err = badger.FetchUptime("unknown", "ctf", now, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !none.From.Equal(now) || none.UnknownSeconds != 0 || len(none.Timeline) != 0 || none.Uptime != nil {
+		t.Errorf("Expected an empty window, got %+v", none)
+	}
+
+	if _, err := badger.FetchUptime("pwn", "yesterday", now, false); err == nil {
+		t.Errorf("Expected error for invalid window")
+	}
+}
@@ -0,0 +1,246 @@
+package checker
+
+// This file decides whether a final result of a test is notified, from the history of test_result.
+// A challenge is alerted when it fails in `alert_threshold` consecutive test cycles,
+// re-alerted every `realert_interval` while it keeps failing, and a recovery is notified once when it becomes solvable again.
+// The state is not stored anywhere: it is replayed from the results since the last success,
+// assuming that every alert was sent.
+// Checker errors (troubles of Docker daemon or registry) neither break nor fix a challenge.
+// Instead, they are notified once for all challenges as the health of the checker, with the same threshold and interval.
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Kinds of notifications.
+const (
+	NotifyAlert    = "alert"
+	NotifyRecovery = "recovery"
+)
+
+// Decision of a notification for a final result of a test.
+type alertDecision struct {
+	kind string // "" if nothing is notified
+	// number of consecutive failed test cycles, including the current one for alerts
+	failures uint
+	// timestamp of the first failure of the consecutive ones
+	broken_since time.Time
+}
+
+type alertTracker struct {
+	logger           *zap.SugaredLogger
+	store            ResultStore
+	threshold        uint
+	realert_interval time.Duration
+}
+
+func new_alert_tracker(logger *zap.SugaredLogger, conf CheckerConfig, store ResultStore) *alertTracker {
+	threshold := conf.AlertThreshold
+	if threshold == 0 {
+		threshold = 1
+	}
+	return &alertTracker{
+		logger:           logger,
+		store:            store,
+		threshold:        threshold,
+		realert_interval: time.Duration(conf.RealertInterval * float64(time.Second)),
+	}
+}
+
+// Results which end a streak of checker errors.
+var checkerHealthyResults = []TestResult{ResultSuccess, ResultTimeout, ResultExecutionFailure, ResultFailure, ResultBuildFailure}
+
+// Final results of past test cycles since the last result in `until`, oldest first.
+// Results for which `skip` returns true and results of the current cycle are excluded,
+// since the latter may not be written yet.
+func (a *alertTracker) cycles_since(chall_name string, run_id string, now time.Time, until []TestResult, skip func(TestResult) bool) ([]DbResult, error) {
+	var since time.Time
+	last, err := a.store.FetchLastResultIn(chall_name, until)
+	switch {
+	case err == nil:
+		since = last.Timestamp
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+
+	results, err := a.store.FetchResultRange(chall_name, since, now)
+	if err != nil {
+		return nil, err
+	}
+	cycles := make([]DbResult, 0, len(results))
+	for _, result := range results {
+		if result.RunID == run_id {
+			continue
+		}
+		// only the last attempt of a cycle is its final result. Results of old schema have no run ID.
+		if n := len(cycles); n > 0 && result.RunID != "" && cycles[n-1].RunID == result.RunID {
+			cycles[n-1] = result
+			continue
+		}
+		cycles = append(cycles, result)
+	}
+	return slices.DeleteFunc(cycles, func(cycle DbResult) bool {
+		return skip(cycle.Result)
+	}), nil
+}
+
+// Final results of past test cycles since the last success, oldest first.
+// Maintenance and checker errors neither break nor fix a challenge.
+func (a *alertTracker) failed_cycles(chall_name string, run_id string, now time.Time) ([]DbResult, error) {
+	return a.cycles_since(chall_name, run_id, now, []TestResult{ResultSuccess}, func(result TestResult) bool {
+		return result == ResultSuccess || result == ResultMaintenance || result == ResultInfraError
+	})
+}
+
+// Time of the last alert sent for the consecutive failures, replaying the alerts.
+func (a *alertTracker) last_alert(cycles []DbResult) time.Time {
+	var last time.Time
+	for i, cycle := range cycles {
+		switch {
+		case uint(i+1) < a.threshold:
+		case uint(i+1) == a.threshold:
+			last = cycle.Timestamp
+		case a.realert_interval > 0 && cycle.Timestamp.Sub(last) >= a.realert_interval:
+			last = cycle.Timestamp
+		}
+	}
+	return last
+}
+
+// Whether the `failures`-th consecutive failure is alerted, given the past failed cycles.
+func (a *alertTracker) should_alert(cycles []DbResult, failures uint, now time.Time) bool {
+	switch {
+	case failures < a.threshold:
+		return false
+	case failures == a.threshold:
+		return true
+	default:
+		return a.realert_interval > 0 && now.Sub(a.last_alert(cycles)) >= a.realert_interval
+	}
+}
+
+// Decide whether the final result of a test in the cycle `run_id` is notified.
+// If the history cannot be read, nothing is notified, since the threshold cannot be applied
+// and every challenge would be alerted at once while the database is down.
+// Checker errors are not notified per challenge, but by decide_health.
+func (a *alertTracker) decide(chall Challenge, result TestResult, run_id string, now time.Time) alertDecision {
+	if result == ResultMaintenance || result == ResultInfraError {
+		return alertDecision{}
+	}
+	cycles, err := a.failed_cycles(chall.Name, run_id, now)
+	if err != nil {
+		a.logger.Errorw("Failed to read history of test results, not notifying", "challenge", chall.Name, "result", result.ToMessage(), "error", err)
+		return alertDecision{}
+	}
+
+	if result == ResultSuccess {
+		if uint(len(cycles)) < a.threshold {
+			return alertDecision{}
+		}
+		return alertDecision{kind: NotifyRecovery, failures: uint(len(cycles)), broken_since: cycles[0].Timestamp}
+	}
+
+	decision := alertDecision{failures: uint(len(cycles)) + 1, broken_since: now}
+	if len(cycles) > 0 {
+		decision.broken_since = cycles[0].Timestamp
+	}
+	if a.should_alert(cycles, decision.failures, now) {
+		decision.kind = NotifyAlert
+	}
+	return decision
+}
+
+// Health of the checker before a test cycle, replayed from the latest results.
+type checkerHealth struct {
+	// challenges whose latest result is a checker error
+	broken map[string]bool
+	// past consecutive test cycles with checker errors, oldest first
+	cycles []DbResult
+}
+
+// Read the health of the checker. This must be called before any result of the cycle is written.
+func (a *alertTracker) checker_health(now time.Time) (checkerHealth, error) {
+	health := checkerHealth{broken: make(map[string]bool)}
+	latest, err := a.store.FetchLatestResults()
+	if err != nil {
+		return health, err
+	}
+	for _, result := range latest {
+		if result.Result != ResultInfraError {
+			continue
+		}
+		health.broken[result.Name] = true
+		// the longest streak among challenges is the one of the checker
+		cycles, err := a.cycles_since(result.Name, "", now, checkerHealthyResults, func(result TestResult) bool {
+			return result != ResultInfraError
+		})
+		if err != nil {
+			return health, err
+		}
+		if len(cycles) > len(health.cycles) {
+			health.cycles = cycles
+		}
+	}
+	return health, nil
+}
+
+// Decide whether the health of the checker is notified after a test cycle.
+// `infra_errors` maps challenges whose final result in the cycle is a checker error to their errors,
+// and `healthy` has the challenges whose final result is not a checker error.
+func (a *alertTracker) decide_health(health checkerHealth, infra_errors map[string]string, healthy map[string]bool, now time.Time) alertDecision {
+	if len(infra_errors) > 0 {
+		decision := alertDecision{failures: uint(len(health.cycles)) + 1, broken_since: now}
+		if len(health.cycles) > 0 {
+			decision.broken_since = health.cycles[0].Timestamp
+		}
+		if a.should_alert(health.cycles, decision.failures, now) {
+			decision.kind = NotifyAlert
+		}
+		return decision
+	}
+
+	// the checker is recovered only when all challenges broken before are tested,
+	// eg: not by a re-run of a single challenge
+	if len(health.broken) == 0 || uint(len(health.cycles)) < a.threshold {
+		return alertDecision{}
+	}
+	for name := range health.broken {
+		if !healthy[name] {
+			return alertDecision{}
+		}
+	}
+	return alertDecision{kind: NotifyRecovery, failures: uint(len(health.cycles)), broken_since: health.cycles[0].Timestamp}
+}
+
+// Notification of the health of the checker. Its challenge is empty, and the affected challenges are listed.
+func health_notification(decision alertDecision, infra_errors map[string]string, run_id string, now time.Time) Notification {
+	n := Notification{
+		Kind:        decision.kind,
+		Result:      ResultInfraError,
+		RunID:       run_id,
+		Timestamp:   now,
+		Failures:    decision.failures,
+		BrokenSince: decision.broken_since,
+	}
+	if decision.kind == NotifyRecovery {
+		n.Result = ResultSuccess
+	}
+	var errlog strings.Builder
+	for name := range infra_errors {
+		n.Affected = append(n.Affected, name)
+	}
+	sort.Strings(n.Affected)
+	for _, name := range n.Affected {
+		fmt.Fprintf(&errlog, "[%s] %s\n", name, infra_errors[name])
+	}
+	n.Errlog = errlog.String()
+	return n
+}
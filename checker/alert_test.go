@@ -0,0 +1,186 @@
+package checker
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func create_sqlite_store(t *testing.T) *SQLStore {
+	t.Helper()
+	db, err := ConnectSQLite(filepath.Join(t.TempDir(), "checker.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewSQLStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if err := store.Migrate(create_logger()); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestAlert_Decide(t *testing.T) {
+	base := time.Date(2023, 10, 15, 12, 0, 0, 0, time.UTC)
+	chall := Challenge{Name: "test"}
+
+	tests := []struct {
+		name      string
+		threshold uint
+		realert   float64
+		results   []TestResult // results of test cycles every 5 minutes, the last one is decided
+		want      []string     // decisions of the results
+	}{
+		{
+			name:      "transitions",
+			threshold: 1,
+			results:   []TestResult{ResultSuccess, ResultFailure, ResultFailure, ResultSuccess, ResultSuccess},
+			want:      []string{"", NotifyAlert, "", NotifyRecovery, ""},
+		},
+		{
+			name:      "threshold",
+			threshold: 3,
+			results:   []TestResult{ResultFailure, ResultFailure, ResultSuccess, ResultFailure, ResultFailure, ResultTimeout, ResultFailure, ResultSuccess},
+			want:      []string{"", "", "", "", "", NotifyAlert, "", NotifyRecovery},
+		},
+		{
+			name:      "realert",
+			threshold: 1,
+			realert:   10 * 60,
+			results:   []TestResult{ResultFailure, ResultFailure, ResultFailure, ResultFailure, ResultFailure, ResultSuccess},
+			want:      []string{NotifyAlert, "", NotifyAlert, "", NotifyAlert, NotifyRecovery},
+		},
+		{
+			// checker errors neither break nor fix a challenge
+			name:      "infra-error",
+			threshold: 1,
+			results:   []TestResult{ResultInfraError, ResultFailure, ResultInfraError, ResultInfraError, ResultFailure, ResultSuccess},
+			want:      []string{"", NotifyAlert, "", "", "", NotifyRecovery},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := create_sqlite_store(t)
+			tracker := new_alert_tracker(create_logger(), CheckerConfig{AlertThreshold: tt.threshold, RealertInterval: tt.realert}, store)
+
+			for i, result := range tt.results {
+				now := base.Add(time.Duration(i) * 5 * time.Minute)
+				run_id := fmt.Sprintf("run%d", i)
+				decision := tracker.decide(chall, result, run_id, now)
+				if decision.kind != tt.want[i] {
+					t.Errorf("decide() of cycle %d got = %q, want %q", i, decision.kind, tt.want[i])
+				}
+				// a failed attempt retried in the same cycle does not count
+				if result != ResultSuccess {
+					retried := TestResultMessage{Result: ResultFailure, Timestamp: now.Add(-time.Minute)}
+					if err := store.RecordResult(chall, retried, run_id, 1); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := store.RecordResult(chall, TestResultMessage{Result: result, Timestamp: now}, run_id, 2); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// Store whose history cannot be read, eg: the database is down.
+type historyErrorStore struct {
+	ResultStore
+}
+
+func (s historyErrorStore) FetchLastResultIn(chall_name string, results []TestResult) (DbResult, error) {
+	return DbResult{}, errors.New("connection refused")
+}
+
+func TestAlert_HistoryError(t *testing.T) {
+	store := historyErrorStore{create_sqlite_store(t)}
+	tracker := new_alert_tracker(create_logger(), CheckerConfig{AlertThreshold: 3}, store)
+	now := time.Date(2023, 10, 15, 12, 0, 0, 0, time.UTC)
+
+	for i, result := range []TestResult{ResultFailure, ResultSuccess} {
+		if decision := tracker.decide(Challenge{Name: "test"}, result, fmt.Sprintf("run%d", i), now); decision.kind != "" {
+			t.Errorf("decide() of %s got = %q, want nothing", result.ToMessage(), decision.kind)
+		}
+	}
+}
+
+func TestAlert_Recovery(t *testing.T) {
+	store := create_sqlite_store(t)
+	tracker := new_alert_tracker(create_logger(), CheckerConfig{}, store)
+	chall := Challenge{Name: "test"}
+	base := time.Date(2023, 10, 15, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		res := TestResultMessage{Result: ResultFailure, Timestamp: base.Add(time.Duration(i) * 5 * time.Minute)}
+		if err := store.RecordResult(chall, res, fmt.Sprintf("run%d", i), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	decision := tracker.decide(chall, ResultSuccess, "run3", base.Add(15*time.Minute))
+	if decision.kind != NotifyRecovery || decision.failures != 3 || !decision.broken_since.Equal(base) {
+		t.Errorf("Unexpected decision: %+v", decision)
+	}
+}
+
+func TestAlert_CheckerHealth(t *testing.T) {
+	store := create_sqlite_store(t)
+	tracker := new_alert_tracker(create_logger(), CheckerConfig{AlertThreshold: 2}, store)
+	base := time.Date(2023, 10, 15, 12, 0, 0, 0, time.UTC)
+
+	cycles := []struct {
+		results map[string]TestResult // final results of the tested challenges
+		want    string
+	}{
+		{map[string]TestResult{"pwn": ResultInfraError, "web": ResultInfraError}, ""},
+		{map[string]TestResult{"pwn": ResultInfraError, "web": ResultSuccess}, NotifyAlert},
+		// pwn is not tested, eg: a re-run of web
+		{map[string]TestResult{"web": ResultSuccess}, ""},
+		{map[string]TestResult{"pwn": ResultFailure, "web": ResultSuccess}, NotifyRecovery},
+		{map[string]TestResult{"pwn": ResultSuccess, "web": ResultSuccess}, ""},
+	}
+	for i, cycle := range cycles {
+		now := base.Add(time.Duration(i) * 5 * time.Minute)
+		run_id := fmt.Sprintf("run%d", i)
+		health, err := tracker.checker_health(now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		infra_errors := make(map[string]string)
+		healthy := make(map[string]bool)
+		for name, result := range cycle.results {
+			if result == ResultInfraError {
+				infra_errors[name] = "docker create failed"
+			} else {
+				healthy[name] = true
+			}
+			if err := store.RecordResult(Challenge{Name: name}, TestResultMessage{Result: result, Timestamp: now}, run_id, 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		decision := tracker.decide_health(health, infra_errors, healthy, now)
+		if decision.kind != cycle.want {
+			t.Errorf("decide_health() of cycle %d got = %q, want %q", i, decision.kind, cycle.want)
+		}
+		switch decision.kind {
+		case NotifyAlert:
+			n := health_notification(decision, infra_errors, run_id, now)
+			if n.Chall.Name != "" || len(n.Affected) != 1 || n.Affected[0] != "pwn" || decision.failures != 2 || !decision.broken_since.Equal(base) {
+				t.Errorf("Unexpected alert: %+v, %+v", decision, n)
+			}
+		case NotifyRecovery:
+			if decision.failures != 2 || !decision.broken_since.Equal(base) {
+				t.Errorf("Unexpected recovery: %+v", decision)
+			}
+		}
+	}
+}
@@ -3,18 +3,23 @@ package checker
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // Challenge information and test configuration
 type Challenge struct {
-	Name      string  `json:"name"`
-	Timeout   float64 `json:"timeout"`
-	Assignee  string  `json:"assignee"`
-	SolverDir string
-	target    Target
+	Name         string  `json:"name"`
+	Timeout      float64 `json:"timeout"`       // legacy timeout used when BuildTimeout or RunTimeout is not set
+	BuildTimeout float64 `json:"build_timeout"` // timeout in seconds to build the solver image
+	RunTimeout   float64 `json:"run_timeout"`   // timeout in seconds to run the solver
+	Assignee     string  `json:"assignee"`
+	Genre        string  `json:"genre"` // default to the name of the genre directory
+	SolverDir    string
+	target       Target
 }
 
 type Target struct {
@@ -40,6 +45,12 @@ func ParseChallenge(path string, targets []Target) (Challenge, error) {
 
 	chall.Name = strings.Replace(chall.Name, " ", "_", -1)
 	chall.SolverDir = filepath.Join(path, "solver")
+	if chall.BuildTimeout == 0 {
+		chall.BuildTimeout = chall.Timeout
+	}
+	if chall.RunTimeout == 0 {
+		chall.RunTimeout = chall.Timeout
+	}
 
 	for _, target := range targets {
 		if target.ChallengeName == chall.Name {
@@ -52,3 +63,16 @@ func ParseChallenge(path string, targets []Target) (Challenge, error) {
 
 	return chall, nil
 }
+
+// Timeout of a test phase.
+// Negative timeout means no limit.
+func (chall *Challenge) phase_timeout(phase TestPhase) time.Duration {
+	timeout := chall.RunTimeout
+	if phase == PhaseBuild {
+		timeout = chall.BuildTimeout
+	}
+	if timeout < 0 || timeout*float64(time.Second) > math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(timeout * float64(time.Second))
+}
@@ -24,8 +24,10 @@ func TestChallenge_ParseChallenge(t *testing.T) {
 				path: "tests/assets/challs/just-success",
 			},
 			want: Challenge{
-				Name:    "just-success",
-				Timeout: 60,
+				Name:         "just-success",
+				Timeout:      60,
+				BuildTimeout: 60,
+				RunTimeout:   60,
 			},
 			wantErr: false,
 		},
@@ -35,8 +37,10 @@ func TestChallenge_ParseChallenge(t *testing.T) {
 				path: "tests/assets/challs/just-fail",
 			},
 			want: Challenge{
-				Name:    "just-fail",
-				Timeout: 60,
+				Name:         "just-fail",
+				Timeout:      60,
+				BuildTimeout: 60,
+				RunTimeout:   60,
 			},
 			wantErr: false,
 		},
@@ -46,8 +50,10 @@ func TestChallenge_ParseChallenge(t *testing.T) {
 				path: "tests/assets/challs/just-success-long",
 			},
 			want: Challenge{
-				Name:    "just-success-long",
-				Timeout: 5,
+				Name:         "just-success-long",
+				Timeout:      5,
+				BuildTimeout: 300,
+				RunTimeout:   5,
 			},
 			wantErr: false,
 		},
@@ -84,6 +90,9 @@ func TestChallenge_ParseChallenge(t *testing.T) {
 			if got.Timeout != tt.want.Timeout {
 				t.Errorf("ParseChallenge() got = %v, want %v", got, tt.want)
 			}
+			if got.BuildTimeout != tt.want.BuildTimeout || got.RunTimeout != tt.want.RunTimeout {
+				t.Errorf("ParseChallenge() got = %v, want %v", got, tt.want)
+			}
 		})
 	}
 }
@@ -1,7 +1,9 @@
 package checker
 
 import (
+	"context"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"math"
 	"os"
@@ -9,8 +11,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
-	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
 )
 
@@ -63,26 +65,37 @@ type asyncTestResult struct {
 	result   TestResultMessage
 }
 
-// Run a test with timeout.
-func run_test(executer Executer, ch chan<- asyncTestResult, conf CheckerConfig) {
-	timeout := executer.chall.Timeout
-	if timeout < 0 {
-		timeout = math.MaxFloat64
-	}
+// Cause of the cancellation of a test which exceeded the timeout of its phase.
+var errTestTimeout = errors.New("Test timed out")
 
+// Run a test with timeout.
+// Build phase and run phase are limited by their own timeouts.
+// Cancelling ctx interrupts the test.
+func run_test(ctx context.Context, executer Executer, ch chan<- asyncTestResult, conf CheckerConfig) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
 	res_chan := make(chan TestResultMessage)
-	killer_chan := make(chan bool)
-	go executer.ExecuteDockerTest(res_chan, killer_chan, conf)
+	go executer.ExecuteDockerTest(ctx, res_chan, conf)
 
-	res := TestResultMessage{ResultRunning, "", ""}
+	res := TestResultMessage{Result: ResultRunning, Phase: PhaseBuild}
+	timer := time.NewTimer(executer.chall.phase_timeout(PhaseBuild))
+	defer func() { timer.Stop() }()
+	timeout_chan := timer.C
 
 	for res.Result == ResultRunning {
 		select {
 		case result := <-res_chan:
+			// restart the timer when the test enters a new phase
+			if result.Result == ResultRunning && result.Phase != res.Phase && timeout_chan != nil {
+				timer.Stop()
+				timer = time.NewTimer(executer.chall.phase_timeout(result.Phase))
+				timeout_chan = timer.C
+			}
 			res = result
-		case <-time.After(time.Duration(timeout) * time.Second):
-			close(killer_chan)
-			res = <-res_chan
+		case <-timeout_chan:
+			executer.logger.Infof("[%s] Timeout of %s phase exceeded.", executer.chall.Name, res.Phase)
+			cancel(errTestTimeout)
+			timeout_chan = nil
 		}
 	}
 
@@ -127,30 +140,48 @@ func parseTargets(logger *zap.SugaredLogger, path string) ([]Target, error) {
 }
 
 // Run all tests using a given configuration, and record the results.
-func RunRecordTests(logger *zap.SugaredLogger, conf CheckerConfig, db *sqlx.DB) error {
-	slack_notifier := NewSlackNotifier(conf.SlackToken, conf.SlackChannel, logger)
+// Cancelling ctx stops launching new tests and interrupts running ones,
+// and it returns after the results already finished are recorded.
+// The returned report has the final result of every challenge, even in dryrun mode.
+func RunRecordTests(ctx context.Context, logger *zap.SugaredLogger, conf CheckerConfig, store ResultStore) (*Report, error) {
+	notifiers := make([]Notifier, 0)
+	if conf.Notify || conf.NotifySlack {
+		var err error
+		if notifiers, err = NewNotifiers(conf, logger, store); err != nil {
+			logger.Errorw("Failed to create notifiers", "error", err)
+			return nil, err
+		}
+	}
 
-	if conf.Dryrun == false && db == nil {
-		logger.Error("DB is nil")
-		return nil
+	if conf.Dryrun == false && store == nil {
+		logger.Error("Result store is nil")
+		return nil, errors.New("Result store is nil")
+	}
+
+	// fail fast instead of failing every test
+	if err := ValidateExtraDockerArg(conf.ExtraDockerArg); err != nil {
+		logger.Errorw("Invalid configuration", "error", err)
+		return nil, err
 	}
 
 	// read targets
 	targets, err := parseTargets(logger, conf.TargetsFile)
 	if err != nil {
 		logger.Errorw(fmt.Sprintf("Failed to parse targets: %s", conf.TargetsFile), "error", err)
-		return err
+		return nil, err
 	}
 
 	// enumerate challenges
 	chall_pathes, err := EnumerateChallenges(conf.ChallsDir, conf.HaveGenreDir)
 	if err != nil {
 		logger.Errorw("Failed to enumerate challenges", "error", err)
-		return err
+		return nil, err
 	}
 	if len(chall_pathes) == 0 {
 		logger.Info("No challenges found")
-		return nil
+		report := new_report(new_run_id(), nil)
+		report.FinishedAt = report.StartedAt
+		return report, nil
 	}
 
 	challs := make([]Challenge, 0)
@@ -161,9 +192,12 @@ func RunRecordTests(logger *zap.SugaredLogger, conf CheckerConfig, db *sqlx.DB)
 				continue
 			} else {
 				logger.Errorw("Failed to parse challenge", "error", err)
-				return err
+				return nil, err
 			}
 		}
+		if conf.HaveGenreDir && chall.Genre == "" {
+			chall.Genre = filepath.Base(filepath.Dir(path))
+		}
 		challs = append(challs, chall)
 	}
 
@@ -181,55 +215,301 @@ func RunRecordTests(logger *zap.SugaredLogger, conf CheckerConfig, db *sqlx.DB)
 	}
 	logger.Infof("Found %d challenges", len(challs))
 
+	// challenges under maintenance are not tested
+	now := time.Now()
+	maintenance := load_maintenance(logger, conf, store, now)
+	all_challs := challs
+	challs = make([]Challenge, 0, len(all_challs))
+	in_maintenance := make([]Challenge, 0)
+	for _, chall := range all_challs {
+		if _, ok := find_maintenance(maintenance, chall, now); ok {
+			in_maintenance = append(in_maintenance, chall)
+		} else {
+			challs = append(challs, chall)
+		}
+	}
+	if len(in_maintenance) > 0 {
+		logger.Infof("Skipping %d challenges under maintenance", len(in_maintenance))
+	}
+
+	docker, err := NewDockerClient()
+	if err != nil {
+		logger.Errorw("Failed to create docker client", "error", err)
+		return nil, err
+	}
+	defer docker.Close()
+
 	executers_wait_queue := make([]Executer, 0)
 	num_running := 0
+	num_backing_off := 0
 	result_chans := make(chan asyncTestResult, len(challs))
+	// at most one retry is pending per challenge, so sending to this channel never blocks.
+	retry_chan := make(chan Executer, len(challs))
+
+	// stop launching new tests once ctx is cancelled.
+	// running tests are cleaned up by each executer.
+	done := ctx.Done()
+	interrupted := false
+
+	run_id := new_run_id()
+	logger.Infof("Starting test cycle %s.", run_id)
+	report := new_report(run_id, all_challs)
+
+	// results are written asynchronously, and spooled to file while the result store is unavailable.
+	// every challenge reports at most one build result and `Retries + 1` test results.
+	var writer *resultWriter
+	if conf.Dryrun == false {
+		if written, err := flush_spool(logger, store, conf.SpoolFile); err != nil {
+			logger.Errorw("Failed to flush spooled results", "error", err)
+		} else if written > 0 {
+			logger.Infof("Recorded %d spooled results.", written)
+		}
+		writer = new_result_writer(logger, store, conf.SpoolFile, len(challs)*int(conf.Retries+2)+len(in_maintenance))
+		defer writer.close()
+	}
+
+	alerts := new_alert_tracker(logger, conf, store)
+	// checker errors are notified once per cycle as the health of the checker, which is read before any result is written
+	var health checkerHealth
+	health_known := false
+	infra_errors := make(map[string]string)
+	healthy := make(map[string]bool)
+	if conf.Dryrun == false && len(notifiers) > 0 {
+		if health, err = alerts.checker_health(now); err != nil {
+			logger.Warnw("Failed to read health of the checker for alerting", "error", err)
+		} else {
+			health_known = true
+		}
+	}
+
+	// record a result of a test, and notify it if it is the final attempt
+	report_result := func(chall Challenge, res TestResultMessage, attempt uint, final bool) {
+		res.Timestamp = time.Now()
+		report.record(chall, res, attempt)
+		if conf.Dryrun {
+			return
+		}
+		res.Stdout = truncate_output(res.Stdout, conf.MaxLogSize)
+		res.Errlog = truncate_output(res.Errlog, conf.MaxLogSize)
+		// the history is read before the result is written.
+		// challenges are not notified during maintenance, even if it started while they were tested.
+		var decision alertDecision
+		_, silenced := find_maintenance(maintenance, chall, res.Timestamp)
+		if final && !silenced && len(notifiers) > 0 {
+			decision = alerts.decide(chall, res.Result, run_id, res.Timestamp)
+			if res.Result == ResultInfraError {
+				infra_errors[chall.Name] = last_line(res.Errlog)
+			} else if res.Result != ResultMaintenance {
+				healthy[chall.Name] = true
+			}
+		}
+		writer.record_result(chall, res, run_id, attempt)
+		if decision.kind == "" {
+			return
+		}
+		notify_all(logger, notifiers, Notification{
+			Kind:        decision.kind,
+			Chall:       chall,
+			Result:      res.Result,
+			Stdout:      res.Stdout,
+			Errlog:      res.Errlog,
+			RunID:       run_id,
+			Attempt:     attempt,
+			Timestamp:   res.Timestamp,
+			Failures:    decision.failures,
+			BrokenSince: decision.broken_since,
+		})
+	}
+
+	for _, chall := range in_maintenance {
+		window, _ := find_maintenance(maintenance, chall, now)
+		logger.Infof("[%s] Under maintenance until %s.", chall.Name, window.End)
+		report_result(chall, TestResultMessage{Result: ResultMaintenance, Stdout: window.message(), Phase: PhaseBuild, ExitCode: -1}, 0, true)
+	}
+
+	// prebuild solver images
+	builds := prebuild_images(ctx, logger, conf, docker, challs)
 
 	// instantiate executers
 	for _, chall := range challs {
+		build := builds[chall.Name]
+		// interrupted builds tell nothing about the challenge
+		if build.result == ResultTestInterrupted {
+			continue
+		}
+		if conf.Dryrun == false {
+			writer.record_build(DbBuildResult{
+				Name:       chall.Name,
+				Result:     build.result,
+				SolverHash: build.solver_hash,
+				Cached:     build.cached,
+				Timestamp:  time.Now(),
+			})
+		}
+		if build.result != ResultSuccess {
+			res := TestResultMessage{Result: build.result, Errlog: build.log, Phase: PhaseBuild, ExitCode: -1, BuildTime: build.build_time}
+			report_result(chall, res, 1, true)
+			continue
+		}
+
 		executer := Executer{
 			challenge_dir: chall.SolverDir,
 			chall:         chall,
 			logger:        logger,
+			attempt:       1,
+			run_id:        run_id,
+			docker:        docker,
+			image:         build.image,
+			build_time:    build.build_time,
 		}
 		executers_wait_queue = append(executers_wait_queue, executer)
 	}
 
-	// initial runs
-	for conf.ParallelNum > uint(num_running) && len(executers_wait_queue) > 0 {
-		executer := executers_wait_queue[0]
-		executers_wait_queue = executers_wait_queue[1:]
-		go run_test(executer, result_chans, conf)
-		num_running++
-	}
-
-	// watch channel
-	for result := range result_chans {
-		num_running--
-
-		for conf.ParallelNum > uint(num_running) && len(executers_wait_queue) > 0 {
+	launch_tests := func() {
+		for !interrupted && conf.ParallelNum > uint(num_running) && len(executers_wait_queue) > 0 {
 			executer := executers_wait_queue[0]
 			executers_wait_queue = executers_wait_queue[1:]
-			go run_test(executer, result_chans, conf)
+			go run_test(ctx, executer, result_chans, conf)
 			num_running++
 		}
+	}
 
-		if conf.Dryrun == false {
-			if err := RecordResult(db, result.executer.chall, result.result.Result); err != nil {
-				logger.Errorw("Failed to record result", "error", err)
-				close(result_chans)
-				return err
+	// initial runs, unless interrupted during the prebuild
+	if ctx.Err() != nil {
+		interrupted = true
+		done = nil
+	}
+	launch_tests()
+
+	// watch channels
+	for num_running > 0 || (!interrupted && (num_backing_off > 0 || len(executers_wait_queue) > 0)) {
+		select {
+		case <-done:
+			if len(executers_wait_queue) > 0 || num_backing_off > 0 {
+				logger.Infof("Test cycle cancelled, skipping %d pending tests.", len(executers_wait_queue)+num_backing_off)
 			}
+			executers_wait_queue = executers_wait_queue[:0]
+			interrupted = true
+			done = nil
+
+		case executer := <-retry_chan:
+			num_backing_off--
+			executers_wait_queue = append(executers_wait_queue, executer)
 
-			if conf.NotifySlack && result.result.Result != ResultSuccess {
-				slack_notifier.NotifyError(result.executer.chall, result.result.Result, result.result.Stdout, result.result.Errlog)
+		case result := <-result_chans:
+			num_running--
+			executer := result.executer
+
+			// interrupted tests tell nothing about the challenge
+			if result.result.Result == ResultTestInterrupted {
+				break
 			}
+
+			final := true
+			if !interrupted && should_retry(conf, result.result.Result, executer.attempt) {
+				final = false
+				backoff := retry_backoff(conf, executer.attempt)
+				logger.Infof("[%s] Attempt %d/%d failed with %s. Retrying in %v.", executer.chall.Name, executer.attempt, conf.Retries+1, result.result.Result.ToMessage(), backoff)
+				next := executer
+				next.attempt++
+				num_backing_off++
+				time.AfterFunc(backoff, func() {
+					retry_chan <- next
+				})
+			}
+
+			report_result(executer.chall, result.result, executer.attempt, final)
 		}
 
-		if num_running == 0 && len(executers_wait_queue) == 0 {
-			close(result_chans)
+		launch_tests()
+	}
+
+	report.Interrupted = interrupted
+	report.FinishedAt = time.Now()
+
+	if health_known {
+		decision := alerts.decide_health(health, infra_errors, healthy, report.FinishedAt)
+		if decision.kind != "" {
+			notify_all(logger, notifiers, health_notification(decision, infra_errors, run_id, report.FinishedAt))
 		}
 	}
+	return report, nil
+}
+
+// Last non-empty line of an output, such as the error appended to stderr.
+func last_line(output string) string {
+	output = strings.TrimSpace(output)
+	return output[strings.LastIndex(output, "\n")+1:]
+}
 
-	return nil
+// Check if a test should be retried after the given attempt (1-origin).
+func should_retry(conf CheckerConfig, result TestResult, attempt uint) bool {
+	if attempt > conf.Retries {
+		return false
+	}
+	return result == ResultFailure || result == ResultTimeout || result == ResultInfraError
+}
+
+// Calculate the backoff before retrying the given attempt (1-origin).
+// The backoff is doubled on each retry.
+func retry_backoff(conf CheckerConfig, attempt uint) time.Duration {
+	backoff := conf.RetryBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	return time.Duration(backoff * math.Pow(2, float64(attempt-1)) * float64(time.Second))
+}
+
+// Cut `s` to at most `n` bytes from its head without splitting a UTF-8 rune.
+func cut_head(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// Cut `s` to at most `n` bytes from its tail without splitting a UTF-8 rune.
+func cut_tail(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if len(s) <= n {
+		return s
+	}
+	i := len(s) - n
+	for i < len(s) && !utf8.RuneStart(s[i]) {
+		i++
+	}
+	return s[i:]
+}
+
+// Truncate output of a solver to at most `max_size` bytes, keeping its head and tail.
+// If `max_size` is not positive, DefaultMaxLogSize is used.
+func truncate_output(output string, max_size int) string {
+	if max_size <= 0 {
+		max_size = DefaultMaxLogSize
+	}
+	if len(output) <= max_size {
+		return output
+	}
+
+	// the marker is included in max_size, and its length depends on the number of truncated bytes
+	keep := max_size
+	for {
+		head := cut_head(output, keep/2)
+		tail := cut_tail(output, keep-keep/2)
+		marker := fmt.Sprintf("\n... (%d bytes truncated) ...\n", len(output)-len(head)-len(tail))
+		if len(head)+len(marker)+len(tail) <= max_size {
+			return strings.ToValidUTF8(head+marker+tail, "")
+		}
+		if keep = max_size - len(marker); keep <= 0 {
+			return strings.ToValidUTF8(cut_head(output, max_size), "")
+		}
+	}
 }
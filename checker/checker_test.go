@@ -3,7 +3,10 @@ package checker
 import (
 	"context"
 	"os"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 )
 
 func TestChecker_RunRecordTests(t *testing.T) {
@@ -13,7 +16,10 @@ func TestChecker_RunRecordTests(t *testing.T) {
 		t.Fatal(err)
 	}
 	defer container.Terminate(ctx)
-	db, _ := container.OpenDB(ctx)
+	store, err := container.OpenStore(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
 	logger := create_logger()
 
 	cwd := testing_cd_root(t)
@@ -25,34 +31,40 @@ func TestChecker_RunRecordTests(t *testing.T) {
 		TargetsFile:  "tests/assets/targets.csv",
 		HaveGenreDir: false,
 		Retries:      3,
+		RetryBackoff: 0.1,
 	}
 
 	// run tests
-	if err := RunRecordTests(logger, conf, db); err != nil {
-		t.Error(err)
+	report, err := RunRecordTests(context.Background(), logger, conf, store)
+	if err != nil {
+		t.Fatal(err)
 	}
 
 	// check results
 	type result struct {
-		name   string
-		result TestResult
+		name    string
+		result  TestResult
+		attempt uint
 	}
 	entries := []result{
 		{
-			name:   "just-success",
-			result: ResultSuccess,
+			name:    "just-success",
+			result:  ResultSuccess,
+			attempt: 1,
 		},
 		{
-			name:   "just-fail",
-			result: ResultFailure,
+			name:    "just-fail",
+			result:  ResultFailure,
+			attempt: 4,
 		},
 		{
-			name:   "just-success-long",
-			result: ResultTimeout,
+			name:    "just-success-long",
+			result:  ResultTimeout,
+			attempt: 4,
 		},
 	}
 	for _, ent := range entries {
-		results, err := FetchResult(db, ent.name, 1)
+		results, err := store.FetchResult(ent.name, 1)
 		if err != nil {
 			t.Error(err)
 		}
@@ -66,5 +78,147 @@ func TestChecker_RunRecordTests(t *testing.T) {
 		if results[0].Result != ent.result {
 			t.Errorf("[%s] Expected result %v, got %v", ent.name, ent.result, results[0].Result)
 		}
+		if results[0].Attempt != ent.attempt {
+			t.Errorf("[%s] Expected attempt %d, got %d", ent.name, ent.attempt, results[0].Attempt)
+		}
+
+		for _, c := range report.Challenges {
+			if c.Name == ent.name && (c.Result != ent.result || c.Attempts != ent.attempt) {
+				t.Errorf("[%s] Expected result %v in attempt %d in report, got %v in attempt %d", ent.name, ent.result, ent.attempt, c.Result, c.Attempts)
+			}
+		}
+	}
+}
+
+func TestChecker_Retry(t *testing.T) {
+	conf := CheckerConfig{
+		Retries:      2,
+		RetryBackoff: 5,
+	}
+
+	tests := []struct {
+		name         string
+		result       TestResult
+		attempt      uint
+		want_retry   bool
+		want_backoff time.Duration
+	}{
+		{"success", ResultSuccess, 1, false, 5 * time.Second},
+		{"failure-1st", ResultFailure, 1, true, 5 * time.Second},
+		{"timeout-2nd", ResultTimeout, 2, true, 10 * time.Second},
+		{"failure-last", ResultFailure, 3, false, 20 * time.Second},
+		{"execution-failure", ResultExecutionFailure, 1, false, 5 * time.Second},
+		{"build-failure", ResultBuildFailure, 1, false, 5 * time.Second},
+		{"infra-error", ResultInfraError, 1, true, 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := should_retry(conf, tt.result, tt.attempt); got != tt.want_retry {
+				t.Errorf("should_retry() = %v, want %v", got, tt.want_retry)
+			}
+			if got := retry_backoff(conf, tt.attempt); got != tt.want_backoff {
+				t.Errorf("retry_backoff() = %v, want %v", got, tt.want_backoff)
+			}
+		})
+	}
+}
+
+func TestChecker_RunTestPhaseTimeout(t *testing.T) {
+	logger := create_logger()
+	solver_dir := t.TempDir()
+	if err := os.WriteFile(solver_dir+"/Dockerfile", []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		docker         *fakeDocker
+		build_timeout  float64
+		run_timeout    float64
+		expected       TestResult
+		expected_phase TestPhase
+		cancel_after   time.Duration // cancel the test cycle after this duration if positive
+	}{
+		{"build-timeout", &fakeDocker{block_build: true}, 0.05, 60, ResultTimeout, PhaseBuild, 0},
+		{"run-timeout", &fakeDocker{block: true}, 60, 0.05, ResultTimeout, PhaseRun, 0},
+		{"no-timeout", &fakeDocker{exit_code: 0}, 60, 60, ResultSuccess, PhaseRun, 0},
+		{"cancelled", &fakeDocker{block: true}, 60, 60, ResultTestInterrupted, PhaseRun, 50 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executer := Executer{
+				challenge_dir: solver_dir,
+				chall: Challenge{
+					Name:         tt.name,
+					BuildTimeout: tt.build_timeout,
+					RunTimeout:   tt.run_timeout,
+					SolverDir:    solver_dir,
+					target:       Target{ChallengeName: tt.name, Host: "localhost", Port: 1337},
+				},
+				logger:  logger,
+				attempt: 1,
+				run_id:  new_run_id(),
+				docker:  tt.docker,
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel_after > 0 {
+				time.AfterFunc(tt.cancel_after, cancel)
+			}
+			ch := make(chan asyncTestResult, 1)
+			run_test(ctx, executer, ch, CheckerConfig{})
+			res := (<-ch).result
+
+			if res.Result != tt.expected {
+				t.Errorf("Expected result %d, got %d", tt.expected, res.Result)
+			}
+			if res.Phase != tt.expected_phase {
+				t.Errorf("Expected phase %s, got %s", tt.expected_phase, res.Phase)
+			}
+		})
+	}
+}
+
+func TestChecker_InvalidExtraDockerArg(t *testing.T) {
+	cwd := testing_cd_root(t)
+	defer os.Chdir(cwd)
+
+	conf := CheckerConfig{
+		ChallsDir:      "tests/assets/challs",
+		TargetsFile:    "tests/assets/targets.csv",
+		ExtraDockerArg: "--device /dev/fuse",
+		Dryrun:         true,
+	}
+	if _, err := RunRecordTests(context.Background(), create_logger(), conf, nil); err == nil {
+		t.Errorf("Expected error for an unsupported docker option before the cycle starts")
+	}
+}
+
+func TestChecker_TruncateOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		max_size int
+		want     string
+	}{
+		{"short", "hello", 10, "hello"},
+		{"exact", "0123456789", 10, "0123456789"},
+		{"long", "0123456789" + strings.Repeat("-", 100) + "abcdefghij", 51, "0123456789\n... (99 bytes truncated) ...\n-abcdefghij"},
+		{"marker-too-long", "0123456789abcdef", 10, "0123456789"},
+		{"multibyte", strings.Repeat("あ", 20), 40, "あ\n... (54 bytes truncated) ...\nあ"},
+		{"multibyte-marker-too-long", strings.Repeat("あ", 20), 10, "あああ"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncate_output(tt.output, tt.max_size); got != tt.want {
+				t.Errorf("truncate_output() = %q, want %q", got, tt.want)
+			}
+			if got := truncate_output(tt.output, tt.max_size); len(got) > tt.max_size || !utf8.ValidString(got) {
+				t.Errorf("truncate_output() has %d bytes, want at most %d valid UTF-8 bytes", len(got), tt.max_size)
+			}
+		})
 	}
 }
@@ -5,20 +5,60 @@ import (
 	"os"
 )
 
+// Default interval in seconds between test cycles in daemon mode.
+const DefaultInterval = 300
+
+// Default maximum size in bytes of each of stdout and stderr recorded in DB.
+const DefaultMaxLogSize = 64 * 1024
+
+// Default backoff in seconds before the first retry of a failed test.
+const DefaultRetryBackoff = 10
+
 type CheckerConfig struct {
-	ParallelNum    uint   `json:"parallel"`
-	ChallsDir      string `json:"challs_dir"`
-	HaveGenreDir   bool   `json:"have_genre_dir"`
-	TargetsFile    string `json:"targets_file"`
-	Retries        uint   `json:"retries"`
-	SkipNonExist   bool   `json:"skip_non_exist"`
-	ExtraDockerArg string
-	SlackToken     string `json:"slack_token"`
-	SlackChannel   string `json:"slack_channel"`
-	NotifySlack    bool
-	Dryrun         bool
-	TargetTests    string // comma separated list of tests to run
-	Vervose        bool
+	ParallelNum       uint    `json:"parallel"`
+	BuildParallelNum  uint    `json:"build_parallel"` // number of parallel builds in the prebuild phase
+	ChallsDir         string  `json:"challs_dir"`
+	HaveGenreDir      bool    `json:"have_genre_dir"`
+	TargetsFile       string  `json:"targets_file"`
+	Retries           uint    `json:"retries"`
+	RetryBackoff      float64 `json:"retry_backoff"` // seconds before the first retry, doubled on each retry
+	SkipNonExist      bool    `json:"skip_non_exist"`
+	MaxLogSize        int     `json:"max_log_size"`     // maximum size in bytes of each of stdout and stderr recorded in DB
+	SpoolFile         string  `json:"spool_file"`       // file where results are kept while DB is unavailable
+	MaintenanceFile   string  `json:"maintenance_file"` // JSON file of maintenance windows
+	ExtraDockerArg    string
+	SlackToken        string           `json:"slack_token"`
+	SlackChannel      string           `json:"slack_channel"`
+	SlackSecret       string           `json:"slack_signing_secret"`
+	Notifiers         []NotifierConfig `json:"notifiers"`        // notifiers used in addition to slack_token and slack_channel
+	AlertThreshold    uint             `json:"alert_threshold"`  // consecutive failed test cycles to alert
+	RealertInterval   float64          `json:"realert_interval"` // seconds between alerts of a challenge which keeps failing. 0 means never
+	NotifySlack       bool
+	Notify            bool // send notifications to the notifiers
+	Dryrun            bool
+	TargetTests       string // comma separated list of tests to run
+	Vervose           bool
+	Daemon            bool
+	Interval          float64  `json:"interval"`  // seconds between test cycles in daemon mode
+	Jitter            float64  `json:"jitter"`    // maximum random delay in seconds added to Interval
+	DbDriver          string   `json:"db_driver"` // "mysql" (default), "sqlite" or "postgres"
+	DbPath            string   `json:"db_path"`   // database file of SQLite
+	DbDSN             string   `json:"db_dsn"`    // full DSN, which overrides the other connection settings
+	DbHost            string   `json:"db_host"`
+	DbPort            int      `json:"db_port"`
+	DbSocket          string   `json:"db_socket"` // unix socket used instead of host and port
+	DbName            string   `json:"db_name"`
+	DbTLS             bool     `json:"db_tls"`
+	DbTLSCA           string   `json:"db_tls_ca"`   // PEM file of the CA certificate
+	DbTLSCert         string   `json:"db_tls_cert"` // PEM file of the client certificate
+	DbTLSKey          string   `json:"db_tls_key"`  // PEM file of the private key of the client certificate
+	DbMaxOpenConns    int      `json:"db_max_open_conns"`
+	DbMaxIdleConns    int      `json:"db_max_idle_conns"`
+	DbConnMaxLifetime float64  `json:"db_conn_max_lifetime"` // seconds
+	FailOn            string   `json:"fail_on"`              // exit policy: "never" (default), "any" or "fraction"
+	FailGenres        []string `json:"fail_genres"`          // genres considered by the exit policy
+	FailChalls        []string `json:"fail_challenges"`      // challenges considered by the exit policy
+	FailFraction      float64  `json:"fail_fraction"`        // maximum fraction of unsolvable challenges with "fraction"
 }
 
 func ReadConf(config_path string) (CheckerConfig, error) {
@@ -0,0 +1,124 @@
+package checker
+
+// This file implements naming, labeling and cleanup of solver containers and images.
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"go.uber.org/zap"
+)
+
+// Labels attached to solver containers and images created by the checker.
+const (
+	labelManaged   = "tsgctf-checker.managed"
+	labelRunID     = "tsgctf-checker.run-id"
+	labelChallenge = "tsgctf-checker.challenge"
+	labelAttempt   = "tsgctf-checker.attempt"
+	labelHost      = "tsgctf-checker.host"
+	labelPid       = "tsgctf-checker.pid"
+	// only for cached images built in the prebuild phase
+	labelSolverHash = "tsgctf-checker.solver-hash"
+)
+
+// Generate an unique ID of a test cycle.
+func new_run_id() string {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// Name of the solver container, unique per run and attempt.
+func (e *Executer) container_name() string {
+	return fmt.Sprintf("container_solver_%s_%s_%d", strings.ToLower(e.chall.Name), e.run_id, e.attempt)
+}
+
+// Name of the solver image, unique per run and attempt.
+func (e *Executer) image_name() string {
+	return fmt.Sprintf("solver_%s:%s-%d", strings.ToLower(e.chall.Name), e.run_id, e.attempt)
+}
+
+// Labels attached to the solver container and image.
+func (e *Executer) labels() map[string]string {
+	hostname, _ := os.Hostname()
+	return map[string]string{
+		labelManaged:   "true",
+		labelRunID:     e.run_id,
+		labelChallenge: e.chall.Name,
+		labelAttempt:   strconv.FormatUint(uint64(e.attempt), 10),
+		labelHost:      hostname,
+		labelPid:       strconv.Itoa(os.Getpid()),
+	}
+}
+
+// Check if a process is alive on this host.
+func process_alive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// Check if a container or image is left behind by a checker process which no longer exists.
+// Resources created on other hosts are never treated as orphaned,
+// because the liveness of their owners cannot be checked.
+func is_orphaned(host string, pid_str string, hostname string, alive func(int) bool) bool {
+	if host != hostname {
+		return false
+	}
+	pid, err := strconv.Atoi(pid_str)
+	if err != nil {
+		return false
+	}
+	return pid != os.Getpid() && !alive(pid)
+}
+
+// Remove solver containers and images left behind by crashed checker processes on this host.
+// Resources of running checker processes are kept untouched,
+// so this is safe to call while other checker processes are running.
+func SweepOrphanedContainers(logger *zap.SugaredLogger, docker DockerClient) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	hostname, _ := os.Hostname()
+	managed := filters.NewArgs(filters.Arg("label", labelManaged))
+
+	containers, err := docker.ContainerList(ctx, types.ContainerListOptions{All: true, Filters: managed})
+	if err != nil {
+		return fmt.Errorf("Failed to list containers: %v", err)
+	}
+	for _, c := range containers {
+		if !is_orphaned(c.Labels[labelHost], c.Labels[labelPid], hostname, process_alive) {
+			continue
+		}
+		if err := docker.ContainerRemove(ctx, c.ID, types.ContainerRemoveOptions{Force: true}); err != nil {
+			logger.Warnf("Failed to remove orphaned container %s: %v", c.ID, err)
+			continue
+		}
+		logger.Infof("Removed orphaned container %s (%s).", c.ID, c.Labels[labelChallenge])
+	}
+
+	images, err := docker.ImageList(ctx, types.ImageListOptions{All: true, Filters: managed})
+	if err != nil {
+		return fmt.Errorf("Failed to list images: %v", err)
+	}
+	for _, image := range images {
+		if !is_orphaned(image.Labels[labelHost], image.Labels[labelPid], hostname, process_alive) {
+			continue
+		}
+		if _, err := docker.ImageRemove(ctx, image.ID, types.ImageRemoveOptions{Force: true}); err != nil {
+			logger.Warnf("Failed to remove orphaned image %s: %v", image.ID, err)
+			continue
+		}
+		logger.Infof("Removed orphaned image %s (%s).", image.ID, image.Labels[labelChallenge])
+	}
+
+	return nil
+}
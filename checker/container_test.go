@@ -0,0 +1,56 @@
+package checker
+
+import (
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestContainer_Naming(t *testing.T) {
+	e1 := &Executer{chall: Challenge{Name: "Just-Success"}, attempt: 1, run_id: new_run_id()}
+	e2 := &Executer{chall: Challenge{Name: "Just-Success"}, attempt: 2, run_id: e1.run_id}
+	e3 := &Executer{chall: Challenge{Name: "Just-Success"}, attempt: 1, run_id: new_run_id()}
+
+	if e1.container_name() == e2.container_name() || e1.container_name() == e3.container_name() {
+		t.Errorf("container names collide: %s, %s, %s", e1.container_name(), e2.container_name(), e3.container_name())
+	}
+	if e1.image_name() == e2.image_name() || e1.image_name() == e3.image_name() {
+		t.Errorf("image names collide: %s, %s, %s", e1.image_name(), e2.image_name(), e3.image_name())
+	}
+	want := "container_solver_just-success_" + e1.run_id + "_1"
+	if e1.container_name() != want {
+		t.Errorf("container_name() = %s, want %s", e1.container_name(), want)
+	}
+
+	labels := e2.labels()
+	if labels[labelManaged] != "true" || labels[labelRunID] != e1.run_id || labels[labelAttempt] != "2" {
+		t.Errorf("labels() = %v", labels)
+	}
+}
+
+func TestContainer_IsOrphaned(t *testing.T) {
+	dead := func(int) bool { return false }
+	alive := func(int) bool { return true }
+
+	tests := []struct {
+		name  string
+		host  string
+		pid   string
+		alive func(int) bool
+		want  bool
+	}{
+		{"dead-owner", "host1", "12345", dead, true},
+		{"alive-owner", "host1", "12345", alive, false},
+		{"other-host", "host2", "12345", dead, false},
+		{"myself", "host1", strconv.Itoa(os.Getpid()), dead, false},
+		{"broken-pid", "host1", "", dead, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := is_orphaned(tt.host, tt.pid, "host1", tt.alive); got != tt.want {
+				t.Errorf("is_orphaned() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package checker
+
+// This file implements the resolution of database connection settings shared by the checker and the badge server.
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Parameters to open a result store.
+// If DSN is set, it is passed to the driver as it is and the connection parameters are ignored.
+type DbParams struct {
+	Driver string // "mysql" (default), "sqlite" or "postgres"
+	DSN    string // data source name in the format of the driver
+	User   string
+	Pass   string
+	Host   string
+	Port   int    // default to the standard port of the driver
+	Socket string // path of the unix socket (MySQL) or the directory containing it (PostgreSQL)
+	Name   string
+	Path   string // database file of SQLite
+	TLS    DbTLS
+	// connection pool limits. 0 means the default of database/sql.
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// TLS settings of a database connection.
+type DbTLS struct {
+	Enabled bool
+	CA      string // PEM file of the CA certificate. System roots are used if empty.
+	Cert    string // PEM file of the client certificate
+	Key     string // PEM file of the private key of the client certificate
+}
+
+// TLS is enabled if it is explicitly enabled or any certificate is given.
+func (t DbTLS) enabled() bool {
+	return t.Enabled || t.CA != "" || t.Cert != "" || t.Key != ""
+}
+
+// Load certificates into TLS configuration which verifies the server as server_name.
+func (t DbTLS) load(server_name string) (*tls.Config, error) {
+	config := &tls.Config{ServerName: server_name, MinVersion: tls.VersionTLS12}
+	if t.CA != "" {
+		pem, err := os.ReadFile(t.CA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificate found in %s", t.CA)
+		}
+		config.RootCAs = pool
+	}
+	if t.Cert != "" || t.Key != "" {
+		cert, err := tls.LoadX509KeyPair(t.Cert, t.Key)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// Resolve database settings from the configuration file and environment variables.
+// Environment variables take priority over the configuration file,
+// so that credentials need not be written in the file.
+func ResolveDbParams(conf CheckerConfig) (DbParams, error) {
+	params := DbParams{
+		Driver: conf.DbDriver,
+		DSN:    conf.DbDSN,
+		Host:   conf.DbHost,
+		Port:   conf.DbPort,
+		Socket: conf.DbSocket,
+		Name:   conf.DbName,
+		Path:   conf.DbPath,
+		TLS: DbTLS{
+			Enabled: conf.DbTLS,
+			CA:      conf.DbTLSCA,
+			Cert:    conf.DbTLSCert,
+			Key:     conf.DbTLSKey,
+		},
+		MaxOpenConns:    conf.DbMaxOpenConns,
+		MaxIdleConns:    conf.DbMaxIdleConns,
+		ConnMaxLifetime: time.Duration(conf.DbConnMaxLifetime * float64(time.Second)),
+	}
+
+	env := func(name string, value *string) {
+		if v := os.Getenv(name); v != "" {
+			*value = v
+		}
+	}
+	env("DBDSN", &params.DSN)
+	env("DBUSER", &params.User)
+	env("DBPASS", &params.Pass)
+	env("DBHOST", &params.Host)
+	env("DBNAME", &params.Name)
+	env("DBSOCKET", &params.Socket)
+	if port := os.Getenv("DBPORT"); port != "" {
+		port_num, err := strconv.Atoi(port)
+		if err != nil {
+			return params, fmt.Errorf("Invalid DBPORT: %s", port)
+		}
+		params.Port = port_num
+	}
+
+	return params, nil
+}
+
+// Apply connection pool limits.
+func (params DbParams) apply_pool(db *sqlx.DB) {
+	if params.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(params.MaxOpenConns)
+	}
+	if params.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(params.MaxIdleConns)
+	}
+	if params.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(params.ConnMaxLifetime)
+	}
+}
+
+// Port to connect, or the default one if not specified.
+func (params DbParams) port_or(default_port int) string {
+	if params.Port != 0 {
+		return strconv.Itoa(params.Port)
+	}
+	return strconv.Itoa(default_port)
+}
@@ -0,0 +1,156 @@
+package checker
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Write a self-signed certificate and its private key in PEM files.
+func write_test_cert(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "db.example.com"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key_der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert_path := filepath.Join(dir, "cert.pem")
+	key_path := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(cert_path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(key_path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key_der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return cert_path, key_path
+}
+
+func TestDbParams_ResolveDbParams(t *testing.T) {
+	conf := CheckerConfig{
+		DbDriver:          "mysql",
+		DbHost:            "conf-host",
+		DbPort:            3307,
+		DbName:            "conf-db",
+		DbMaxOpenConns:    8,
+		DbConnMaxLifetime: 1.5,
+	}
+	t.Setenv("DBUSER", "env-user")
+	t.Setenv("DBPASS", "env-pass")
+	t.Setenv("DBHOST", "env-host")
+	t.Setenv("DBNAME", "")
+	t.Setenv("DBPORT", "")
+
+	params, err := ResolveDbParams(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// environment variables take priority, and empty ones are ignored
+	if params.User != "env-user" || params.Pass != "env-pass" || params.Host != "env-host" || params.Name != "conf-db" || params.Port != 3307 {
+		t.Errorf("Unexpected params: %+v", params)
+	}
+	if params.MaxOpenConns != 8 || params.ConnMaxLifetime != 1500*time.Millisecond {
+		t.Errorf("Unexpected pool limits: %+v", params)
+	}
+
+	t.Setenv("DBPORT", "13306")
+	if params, err := ResolveDbParams(conf); err != nil || params.Port != 13306 {
+		t.Errorf("DBPORT is not applied: %+v, %v", params, err)
+	}
+	t.Setenv("DBPORT", "mysql")
+	if _, err := ResolveDbParams(conf); err == nil {
+		t.Errorf("Invalid DBPORT must be rejected")
+	}
+}
+
+func TestDbParams_MysqlConfig(t *testing.T) {
+	cert, key := write_test_cert(t, t.TempDir())
+
+	tests := []struct {
+		name      string
+		params    DbParams
+		want_net  string
+		want_addr string
+		want_tls  bool
+	}{
+		{"default-port", DbParams{Host: "db"}, "tcp", "db:3306", false},
+		{"custom-port", DbParams{Host: "db", Port: 13306}, "tcp", "db:13306", false},
+		{"socket", DbParams{Host: "db", Socket: "/run/mysqld/mysqld.sock"}, "unix", "/run/mysqld/mysqld.sock", false},
+		{"tls", DbParams{Host: "db", TLS: DbTLS{Enabled: true}}, "tcp", "db:3306", true},
+		{"tls-client-cert", DbParams{Host: "db", TLS: DbTLS{CA: cert, Cert: cert, Key: key}}, "tcp", "db:3306", true},
+		{"dsn", DbParams{Host: "ignored", DSN: "user:pass@tcp(managed:25060)/db?tls=true"}, "tcp", "managed:25060", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := mysql_config(tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Net != tt.want_net || cfg.Addr != tt.want_addr {
+				t.Errorf("Expected %s(%s), got %s(%s)", tt.want_net, tt.want_addr, cfg.Net, cfg.Addr)
+			}
+			if (cfg.TLS != nil || cfg.TLSConfig != "") != tt.want_tls {
+				t.Errorf("Expected TLS %v, got %+v", tt.want_tls, cfg.TLS)
+			}
+			if !cfg.ParseTime {
+				t.Errorf("ParseTime must be enabled")
+			}
+		})
+	}
+
+	// certificates are verified on loading
+	if _, err := mysql_config(DbParams{Host: "db", TLS: DbTLS{CA: key}}); err == nil {
+		t.Errorf("CA file without certificates must be rejected")
+	}
+	if _, err := mysql_config(DbParams{Host: "db", TLS: DbTLS{Cert: cert}}); err == nil {
+		t.Errorf("Client certificate without private key must be rejected")
+	}
+	// the server name cannot be verified over a socket
+	if _, err := mysql_config(DbParams{Socket: "/run/mysqld/mysqld.sock", TLS: DbTLS{Enabled: true}}); err == nil {
+		t.Errorf("TLS with a unix socket must be rejected")
+	}
+}
+
+func TestDbParams_PostgresDSN(t *testing.T) {
+	dsn := postgres_dsn(DbParams{Host: "db", User: "user", Pass: "it's secret", Name: "test"})
+	for _, want := range []string{"host='db'", "port=5432", `password='it\'s secret'`, "sslmode=disable"} {
+		if !strings.Contains(dsn, want) {
+			t.Errorf("%q does not contain %q", dsn, want)
+		}
+	}
+
+	dsn = postgres_dsn(DbParams{Host: "db", Socket: "/var/run/postgresql", Port: 15432, TLS: DbTLS{CA: "/etc/ca.pem"}})
+	for _, want := range []string{"host='/var/run/postgresql'", "port=15432", "sslmode=verify-full", "sslrootcert='/etc/ca.pem'"} {
+		if !strings.Contains(dsn, want) {
+			t.Errorf("%q does not contain %q", dsn, want)
+		}
+	}
+
+	if dsn := postgres_dsn(DbParams{Host: "ignored", DSN: "postgres://managed/db"}); dsn != "postgres://managed/db" {
+		t.Errorf("DSN must be used as it is, got %q", dsn)
+	}
+}
@@ -0,0 +1,375 @@
+package checker
+
+// This file implements the access to Docker Engine API used by executers.
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/go-units"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Subset of Docker Engine API used by the checker.
+// `*client.Client` satisfies this interface,
+// and a fake implementation can be used instead in unit tests.
+type DockerClient interface {
+	ImageBuild(ctx context.Context, buildContext io.Reader, options types.ImageBuildOptions) (types.ImageBuildResponse, error)
+	ImageRemove(ctx context.Context, imageID string, options types.ImageRemoveOptions) ([]types.ImageDeleteResponseItem, error)
+	ImageList(ctx context.Context, options types.ImageListOptions) ([]types.ImageSummary, error)
+	ImageInspectWithRaw(ctx context.Context, imageID string) (types.ImageInspect, []byte, error)
+	ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *ocispec.Platform, containerName string) (container.CreateResponse, error)
+	ContainerStart(ctx context.Context, containerID string, options types.ContainerStartOptions) error
+	ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error)
+	ContainerLogs(ctx context.Context, container string, options types.ContainerLogsOptions) (io.ReadCloser, error)
+	ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error
+	ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error)
+	Close() error
+}
+
+// Connect to Docker Engine specified by environment variables (`DOCKER_HOST` etc).
+// Default to the unix socket `/var/run/docker.sock`.
+func NewDockerClient() (DockerClient, error) {
+	return client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+}
+
+// Step of a docker test.
+type DockerStep string
+
+const (
+	StepBuild  DockerStep = "build"
+	StepCreate DockerStep = "create"
+	StepStart  DockerStep = "start"
+	StepWait   DockerStep = "wait"
+	StepRemove DockerStep = "remove"
+)
+
+// Error occurred in a step of a docker test.
+// Note that a solver exiting with non-zero status is not a DockerError.
+type DockerError struct {
+	Step DockerStep
+	Err  error
+}
+
+func (e *DockerError) Error() string {
+	return fmt.Sprintf("docker %s failed: %v", e.Step, e.Err)
+}
+
+func (e *DockerError) Unwrap() error {
+	return e.Err
+}
+
+// Substrings of build error messages caused by Docker daemon or registry, not by Dockerfile.
+var infraErrorPatterns = []string{
+	"toomanyrequests",
+	"tls handshake timeout",
+	"i/o timeout",
+	"connection refused",
+	"connection reset",
+	"no such host",
+	"service unavailable",
+	"bad gateway",
+	"gateway timeout",
+	"internal server error",
+	"unexpected eof",
+	"no space left on device",
+}
+
+// Classify an error of docker operations into a test result.
+// Errors reported by the build of the solver's Dockerfile are ResultBuildFailure,
+// and the others (troubles of Docker daemon or registry) are ResultInfraError.
+func classify_docker_error(err error) TestResult {
+	var docker_err *DockerError
+	if !errors.As(err, &docker_err) || docker_err.Step != StepBuild {
+		return ResultInfraError
+	}
+	// errors not reported in the build stream come from the daemon itself
+	var build_err *jsonmessage.JSONError
+	if !errors.As(err, &build_err) {
+		return ResultInfraError
+	}
+
+	message := strings.ToLower(build_err.Message)
+	for _, pattern := range infraErrorPatterns {
+		if strings.Contains(message, pattern) {
+			return ResultInfraError
+		}
+	}
+	return ResultBuildFailure
+}
+
+// Create a tar archive of the solver directory as a build context.
+// Files matching `.dockerignore` are excluded.
+func build_context(solver_dir string) (io.ReadCloser, error) {
+	excludes := make([]string, 0)
+	if f, err := os.Open(filepath.Join(solver_dir, ".dockerignore")); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			excludes = append(excludes, filepath.Clean(line))
+		}
+		f.Close()
+	}
+
+	return archive.TarWithOptions(solver_dir, &archive.TarOptions{ExcludePatterns: excludes})
+}
+
+// Build an image from the solver directory and return the build log.
+func build_image(ctx context.Context, docker DockerClient, solver_dir string, image_name string, labels map[string]string) (string, error) {
+	build_ctx, err := build_context(solver_dir)
+	if err != nil {
+		return "", &DockerError{StepBuild, err}
+	}
+	defer build_ctx.Close()
+
+	build_res, err := docker.ImageBuild(ctx, build_ctx, types.ImageBuildOptions{
+		Tags:        []string{image_name},
+		Labels:      labels,
+		Remove:      true,
+		ForceRemove: true,
+	})
+	if err != nil {
+		return "", &DockerError{StepBuild, err}
+	}
+	defer build_res.Body.Close()
+
+	var build_log bytes.Buffer
+	if err := jsonmessage.DisplayJSONMessagesStream(build_res.Body, &build_log, 0, false, nil); err != nil {
+		return build_log.String(), &DockerError{StepBuild, err}
+	}
+	return build_log.String(), nil
+}
+
+// Split command-line arguments respecting single and double quotes.
+func split_args(s string) ([]string, error) {
+	args := make([]string, 0)
+	var current strings.Builder
+	var quote rune
+	in_arg := false
+
+	for _, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				current.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			in_arg = true
+		case unicode.IsSpace(c):
+			if in_arg {
+				args = append(args, current.String())
+				current.Reset()
+				in_arg = false
+			}
+		default:
+			current.WriteRune(c)
+			in_arg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("Unterminated quote in %q", s)
+	}
+	if in_arg {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
+
+// Options of "docker run" command which take no value, eg: `--privileged` or `--privileged=false`.
+var dockerBoolOptions = map[string]bool{
+	"--privileged": true,
+	"--read-only":  true,
+	"--init":       true,
+}
+
+// Options of "docker run" command which take a value, eg: `--network host` or `--network=host`.
+var dockerValueOptions = map[string]bool{
+	"--network":      true,
+	"--net":          true,
+	"--add-host":     true,
+	"--env":          true,
+	"-e":             true,
+	"--dns":          true,
+	"--memory":       true,
+	"-m":             true,
+	"--memory-swap":  true,
+	"--cpus":         true,
+	"--pids-limit":   true,
+	"--shm-size":     true,
+	"--ulimit":       true,
+	"--volume":       true,
+	"-v":             true,
+	"--tmpfs":        true,
+	"--cap-add":      true,
+	"--cap-drop":     true,
+	"--security-opt": true,
+	"--sysctl":       true,
+	"--user":         true,
+	"-u":             true,
+	"--workdir":      true,
+	"-w":             true,
+}
+
+// Check that extra arguments of "docker run" command are supported.
+// This is meant to be called once when the configuration is loaded.
+func ValidateExtraDockerArg(extra string) error {
+	if err := apply_extra_docker_arg(extra, &container.Config{}, &container.HostConfig{}); err != nil {
+		return fmt.Errorf("Invalid extra docker argument %q: %v", extra, err)
+	}
+	return nil
+}
+
+// Apply extra arguments of "docker run" command to container configuration.
+// Only the options in dockerBoolOptions and dockerValueOptions are supported.
+func apply_extra_docker_arg(extra string, config *container.Config, host_config *container.HostConfig) error {
+	args, err := split_args(extra)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(args); i++ {
+		name, value, has_value := strings.Cut(args[i], "=")
+		switch {
+		case dockerBoolOptions[name]:
+			if !has_value {
+				value = "true"
+			}
+		case dockerValueOptions[name]:
+			if !has_value {
+				if i+1 >= len(args) {
+					return fmt.Errorf("Missing value for docker option %s", name)
+				}
+				i++
+				value = args[i]
+			}
+		default:
+			return fmt.Errorf("Unsupported docker option: %s", name)
+		}
+
+		if err := apply_docker_option(name, value, config, host_config); err != nil {
+			return fmt.Errorf("Invalid value for %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// Apply a single option of "docker run" command.
+func apply_docker_option(name string, value string, config *container.Config, host_config *container.HostConfig) error {
+	switch name {
+	case "--privileged", "--read-only", "--init":
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		switch name {
+		case "--privileged":
+			host_config.Privileged = enabled
+		case "--read-only":
+			host_config.ReadonlyRootfs = enabled
+		case "--init":
+			host_config.Init = &enabled
+		}
+	case "--network", "--net":
+		host_config.NetworkMode = container.NetworkMode(value)
+	case "--add-host":
+		host_config.ExtraHosts = append(host_config.ExtraHosts, value)
+	case "--env", "-e":
+		config.Env = append(config.Env, value)
+	case "--dns":
+		host_config.DNS = append(host_config.DNS, value)
+	case "--memory", "-m":
+		memory, err := units.RAMInBytes(value)
+		if err != nil {
+			return err
+		}
+		host_config.Memory = memory
+	case "--memory-swap":
+		if value == "-1" {
+			host_config.MemorySwap = -1
+			break
+		}
+		swap, err := units.RAMInBytes(value)
+		if err != nil {
+			return err
+		}
+		host_config.MemorySwap = swap
+	case "--cpus":
+		cpus, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		host_config.NanoCPUs = int64(cpus * 1e9)
+	case "--pids-limit":
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		host_config.PidsLimit = &limit
+	case "--shm-size":
+		size, err := units.RAMInBytes(value)
+		if err != nil {
+			return err
+		}
+		host_config.ShmSize = size
+	case "--ulimit":
+		ulimit, err := units.ParseUlimit(value)
+		if err != nil {
+			return err
+		}
+		host_config.Ulimits = append(host_config.Ulimits, ulimit)
+	case "--volume", "-v":
+		if !strings.Contains(value, ":") {
+			return errors.New("Anonymous volumes are not supported")
+		}
+		host_config.Binds = append(host_config.Binds, value)
+	case "--tmpfs":
+		path, options, _ := strings.Cut(value, ":")
+		if host_config.Tmpfs == nil {
+			host_config.Tmpfs = make(map[string]string)
+		}
+		host_config.Tmpfs[path] = options
+	case "--cap-add":
+		host_config.CapAdd = append(host_config.CapAdd, value)
+	case "--cap-drop":
+		host_config.CapDrop = append(host_config.CapDrop, value)
+	case "--security-opt":
+		host_config.SecurityOpt = append(host_config.SecurityOpt, value)
+	case "--sysctl":
+		key, val, ok := strings.Cut(value, "=")
+		if !ok {
+			return errors.New("Expected key=value")
+		}
+		if host_config.Sysctls == nil {
+			host_config.Sysctls = make(map[string]string)
+		}
+		host_config.Sysctls[key] = val
+	case "--user", "-u":
+		config.User = value
+	case "--workdir", "-w":
+		config.WorkingDir = value
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package checker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-units"
+)
+
+func TestDocker_ApplyExtraDockerArg(t *testing.T) {
+	tests := []struct {
+		name      string
+		arg       string
+		want_host container.HostConfig
+		want_env  []string
+		wantErr   bool
+	}{
+		{
+			name:      "empty",
+			arg:       "",
+			want_host: container.HostConfig{},
+		},
+		{
+			name:      "network-quoted",
+			arg:       `--network="host"`,
+			want_host: container.HostConfig{NetworkMode: "host"},
+		},
+		{
+			name:      "multiple",
+			arg:       "--net bridge --add-host example.example:127.0.0.1 -e 'FOO=bar baz' --memory 512m --cpus=1.5",
+			want_host: container.HostConfig{NetworkMode: "bridge", ExtraHosts: []string{"example.example:127.0.0.1"}, Resources: container.Resources{Memory: 512 * 1024 * 1024, NanoCPUs: 1500000000}},
+			want_env:  []string{"FOO=bar baz"},
+		},
+		{
+			name: "privileges",
+			arg:  "--privileged --cap-add SYS_PTRACE --security-opt seccomp=unconfined --init --read-only=false",
+			want_host: container.HostConfig{
+				Privileged:  true,
+				CapAdd:      []string{"SYS_PTRACE"},
+				SecurityOpt: []string{"seccomp=unconfined"},
+				Init:        &[]bool{true}[0],
+			},
+		},
+		{
+			name: "filesystem",
+			arg:  "-v /tmp/cache:/cache:ro --tmpfs /run:rw,size=64m --ulimit nofile=1024:2048 --pids-limit 100",
+			want_host: container.HostConfig{
+				Binds: []string{"/tmp/cache:/cache:ro"},
+				Tmpfs: map[string]string{"/run": "rw,size=64m"},
+				Resources: container.Resources{
+					Ulimits:   []*units.Ulimit{{Name: "nofile", Soft: 1024, Hard: 2048}},
+					PidsLimit: &[]int64{100}[0],
+				},
+			},
+		},
+		{
+			name:    "unsupported",
+			arg:     "--device /dev/fuse",
+			wantErr: true,
+		},
+		{
+			name:    "invalid-bool",
+			arg:     "--privileged=maybe",
+			wantErr: true,
+		},
+		{
+			name:    "missing-value",
+			arg:     "--network",
+			wantErr: true,
+		},
+		{
+			name:    "unterminated",
+			arg:     `--network="host`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := container.Config{}
+			host_config := container.HostConfig{}
+			err := apply_extra_docker_arg(tt.arg, &config, &host_config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("apply_extra_docker_arg() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(host_config, tt.want_host) {
+				t.Errorf("apply_extra_docker_arg() host config = %+v, want %+v", host_config, tt.want_host)
+			}
+			if !reflect.DeepEqual(config.Env, tt.want_env) {
+				t.Errorf("apply_extra_docker_arg() env = %v, want %v", config.Env, tt.want_env)
+			}
+		})
+	}
+}
+
+func TestDocker_ValidateExtraDockerArg(t *testing.T) {
+	if err := ValidateExtraDockerArg("--network host -v /tmp:/tmp"); err != nil {
+		t.Errorf("ValidateExtraDockerArg() error = %v", err)
+	}
+	err := ValidateExtraDockerArg("--device /dev/fuse")
+	if err == nil || !strings.Contains(err.Error(), "--device") {
+		t.Errorf("ValidateExtraDockerArg() error = %v, want an error mentioning --device", err)
+	}
+}
@@ -4,28 +4,67 @@ package checker
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
-	"os/signal"
 	"path/filepath"
-	"strings"
-	"syscall"
+	"strconv"
+	"time"
 
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
 	"go.uber.org/zap"
 )
 
+// Timeout of docker operations to clean up a test.
+const cleanupTimeout = 30 * time.Second
+
 // Executer of a single test.
 type Executer struct {
 	challenge_dir string
 	logger        *zap.SugaredLogger
 	chall         Challenge
+	attempt       uint   // 1-origin attempt number of the test
+	run_id        string // unique ID of the test cycle
+	docker        DockerClient
+	image         string        // prebuilt solver image. If empty, the image is built in the test.
+	build_time    time.Duration // time taken to prebuild the image
 }
 
 type TestResultMessage struct {
 	Result TestResult
 	Stdout string
 	Errlog string
+	Phase  TestPhase // phase of the test when the message is sent
+	// exit code of the solver. -1 if the solver did not finish.
+	ExitCode  int
+	BuildTime time.Duration
+	RunTime   time.Duration
+	// time when the result is reported by RunRecordTests. Zero until then.
+	Timestamp time.Time
+}
+
+// Phase of a test
+type TestPhase int
+
+const (
+	// Building the solver image
+	PhaseBuild TestPhase = iota
+	// Running the solver container
+	PhaseRun
+)
+
+func (phase TestPhase) String() string {
+	switch phase {
+	case PhaseBuild:
+		return "build"
+	case PhaseRun:
+		return "run"
+	default:
+		return "unknown"
+	}
 }
 
 // Test result
@@ -38,12 +77,18 @@ const (
 	ResultTimeout
 	// Test failed to execute
 	ResultExecutionFailure
-	// Test interrupted by signal
+	// Test interrupted by cancellation of the test cycle
 	ResultTestInterrupted
 	// Test failed
 	ResultFailure
 	// Test running
 	ResultRunning
+	// Solver image failed to build
+	ResultBuildFailure
+	// Test could not run due to troubles of Docker daemon or registry
+	ResultInfraError
+	// Test skipped during a maintenance window
+	ResultMaintenance
 )
 
 func (tr TestResult) ToMessage() string {
@@ -56,6 +101,12 @@ func (tr TestResult) ToMessage() string {
 		return "Unsolvable"
 	case ResultRunning:
 		return "Running"
+	case ResultBuildFailure:
+		return "Build Failed"
+	case ResultInfraError:
+		return "Checker Error"
+	case ResultMaintenance:
+		return "Maintenance"
 	default:
 		return "Unknown"
 	}
@@ -71,111 +122,227 @@ func (tr TestResult) ToColor() string {
 		return "CC0000"
 	case ResultRunning:
 		return "C0C0C0"
+	case ResultBuildFailure:
+		return "FF8C00"
+	case ResultInfraError:
+		return "808080"
+	case ResultMaintenance:
+		return "1E90FF"
 	default:
 		return "C0C0C0"
 	}
 }
 
-func (e *Executer) check_before_execution() error {
+func (e *Executer) check_before_execution(conf CheckerConfig) error {
 	// check if Dockerfile exists
 	if _, err := os.Stat(filepath.Join(e.chall.SolverDir, "Dockerfile")); os.IsNotExist(err) {
 		return fmt.Errorf("[%s] Dockerfile not found in %s", e.chall.Name, e.challenge_dir)
 	}
+	// errors of the configuration are not troubles of Docker
+	if err := ValidateExtraDockerArg(conf.ExtraDockerArg); err != nil {
+		return err
+	}
 
 	return nil
 }
 
 // Execute a test using a Dockerfile.
-// This function is blocked until the subprocess finishes.
+// This function is blocked until the solver container finishes.
 // The caller can get the test result from res_chan.
-// The caller can kill the subprocess by sending a signal to killer_chan and it returns ResultTimeout.
-// This function is notified if SIGTERM or SIGINT is sent to the process,
-// and it cleans up subprocess and returns ResultTestInterrupted.
-// Note that it sends ResultRunning to res_chan when it starts executing the test.
-func (e *Executer) ExecuteDockerTest(res_chan chan TestResultMessage, killer_chan <-chan bool, conf CheckerConfig) {
-	if err := e.check_before_execution(); err != nil {
-		e.logger.Errorf("[%s] Failed to execute test: \n%w", e.chall.Name, err)
-		res_chan <- TestResultMessage{Result: ResultExecutionFailure, Errlog: err.Error()}
+// When ctx is cancelled, it cleans up the container and returns ResultTestInterrupted,
+// or ResultTimeout with the phase in which the test timed out if the cause of the cancellation is errTestTimeout.
+// If the Dockerfile is missing or ExtraDockerArg is invalid, it returns ResultExecutionFailure.
+// If the image cannot be built, it returns ResultBuildFailure.
+// If the test cannot be run due to troubles of Docker daemon or registry, it returns ResultInfraError.
+// Note that it sends ResultRunning to res_chan when it starts building the image (PhaseBuild)
+// and when it starts running the container (PhaseRun).
+func (e *Executer) ExecuteDockerTest(ctx context.Context, res_chan chan TestResultMessage, conf CheckerConfig) {
+	if err := e.check_before_execution(conf); err != nil {
+		e.logger.Errorf("[%s] Failed to execute test: \n%v", e.chall.Name, err)
+		res_chan <- TestResultMessage{Result: ResultExecutionFailure, Errlog: err.Error(), ExitCode: -1}
 		return
 	}
-
-	// prepare command
 	chall := e.chall
-	container_name := fmt.Sprintf("container_solver_%s", strings.ToLower(chall.Name))
-	image_name := fmt.Sprintf("solver_%s", strings.ToLower(chall.Name))
-	cmd := exec.Command("bash", "-c", fmt.Sprintf("docker run %s --name %s --rm $(docker build -qt %s %s) %s %d", conf.ExtraDockerArg, container_name, image_name, chall.SolverDir, chall.target.Host, chall.target.Port))
 
-	var errbuf bytes.Buffer
-	var outbuf bytes.Buffer
-	cmd.Stderr = &errbuf
-	cmd.Stdout = &outbuf
-
-	// termination signal hook
-	signal_chan := make(chan os.Signal, 1)
-	signal.Notify(signal_chan, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
-
-	// execute test async
-	res_chan_internal := make(chan error)
-	if err := cmd.Start(); err != nil {
-		e.logger.Warnf("[%s] Failed to start test: \n%w", chall.Name, err)
-		res_chan <- TestResultMessage{ResultFailure, outbuf.String(), err.Error()}
-		return
+	phase := PhaseBuild
+	if e.image != "" {
+		phase = PhaseRun
 	}
-	res_chan <- TestResultMessage{ResultRunning, outbuf.String(), errbuf.String()}
-	e.logger.Infof("[%s] Test started as pid %d in %s.", chall.Name, cmd.Process.Pid, container_name)
-	go func() {
-		res_chan_internal <- cmd.Wait()
-	}()
-
-	cleanup_container := func() {
-		// check if process is running
-		// kill process
-		if err := cmd.Process.Signal(os.Interrupt); err != nil {
-			if err.Error() != "os: process already finished" {
-				e.logger.Errorf("[%s] Failed to kill process: %v", chall.Name, err)
-			}
-		}
-		// remove container
-		if err := exec.Command("docker", "stop", container_name).Run(); err != nil {
-			e.logger.Errorf("[%s] Failed to remove container (%s):\n%v", chall.Name, container_name, err)
+	res_chan <- TestResultMessage{Result: ResultRunning, Phase: phase}
+	run, err := e.run_container(ctx, conf, func() {
+		phase = PhaseRun
+		res_chan <- TestResultMessage{Result: ResultRunning, Phase: phase}
+	})
+	if e.image != "" {
+		run.build_time = e.build_time
+	}
+	message := func(result TestResult, errlog string) TestResultMessage {
+		return TestResultMessage{
+			Result:    result,
+			Stdout:    run.stdout,
+			Errlog:    errlog,
+			Phase:     phase,
+			ExitCode:  int(run.exit_code),
+			BuildTime: run.build_time,
+			RunTime:   run.run_time,
 		}
 	}
 
-	// wait for result
-	select {
-	// checker process terminated by signal
-	case <-signal_chan:
-		e.logger.Infof("[%s] Checker process interrupted, cleaning up docker container...", chall.Name)
-		cleanup_container()
-		res_chan <- TestResultMessage{ResultTestInterrupted, "", "Interrupted by signal."}
-		break
-	// timeout
-	case <-killer_chan:
-		e.logger.Infof("[%s] Test timed out. Stopping container.", chall.Name)
-		cleanup_container()
+	if ctx.Err() != nil {
 		e.logger.Infof("[%s] Container stopped.", chall.Name)
 		if conf.Vervose {
-			e.logger.Infof("[%s] stdout: %s", chall.Name, outbuf.String())
-			e.logger.Infof("[%s] stderr: %s", chall.Name, errbuf.String())
+			e.logger.Infof("[%s] stdout: %s", chall.Name, run.stdout)
+			e.logger.Infof("[%s] stderr: %s", chall.Name, run.stderr)
 		}
-		res_chan <- TestResultMessage{ResultTimeout, outbuf.String(), errbuf.String()}
-		break
-	// test finished
-	case err := <-res_chan_internal:
-		if err != nil {
-			if exiterr, ok := err.(*exec.ExitError); ok {
-				e.logger.Infof("[%s] Test failed with status %d", chall.Name, exiterr.ExitCode())
-				if conf.Vervose {
-					e.logger.Infof("[%s] stdout: %s", chall.Name, outbuf.String())
-					e.logger.Infof("[%s] stderr: %s", chall.Name, errbuf.String())
-				}
-				res_chan <- TestResultMessage{ResultFailure, outbuf.String(), errbuf.String()}
-			}
+		if errors.Is(context.Cause(ctx), errTestTimeout) {
+			e.logger.Infof("[%s] Timed out in %s phase.", chall.Name, phase)
+			res_chan <- message(ResultTimeout, fmt.Sprintf("%s\nTimed out in %s phase.", run.stderr, phase))
 		} else {
-			// test ends without any failure
-			e.logger.Infof("[%s] exits with status code 0.", chall.Name)
-			res_chan <- TestResultMessage{ResultSuccess, "", ""}
+			res_chan <- TestResultMessage{Result: ResultTestInterrupted, Errlog: "Interrupted.", Phase: phase, ExitCode: -1}
+		}
+		return
+	}
+
+	if err != nil {
+		e.logger.Warnf("[%s] Failed to execute test: %v", chall.Name, err)
+		res_chan <- message(classify_docker_error(err), fmt.Sprintf("%s\n%v", run.stderr, err))
+		return
+	}
+
+	if run.exit_code != 0 {
+		e.logger.Infof("[%s] Test failed with status %d in %v", chall.Name, run.exit_code, run.run_time.Round(time.Millisecond))
+		if conf.Vervose {
+			e.logger.Infof("[%s] stdout: %s", chall.Name, run.stdout)
+			e.logger.Infof("[%s] stderr: %s", chall.Name, run.stderr)
+		}
+		res_chan <- message(ResultFailure, run.stderr)
+		return
+	}
+
+	// test ends without any failure
+	e.logger.Infof("[%s] exits with status code 0 in %v.", chall.Name, run.run_time.Round(time.Millisecond))
+	if conf.Vervose {
+		e.logger.Infof("[%s] stdout: %s", chall.Name, run.stdout)
+		e.logger.Infof("[%s] stderr: %s", chall.Name, run.stderr)
+	}
+	res_chan <- message(ResultSuccess, run.stderr)
+}
+
+// Outcome of a solver container.
+type containerRun struct {
+	exit_code  int64 // -1 if the container did not finish
+	stdout     string
+	stderr     string
+	build_time time.Duration
+	run_time   time.Duration
+}
+
+// Build the solver image, run it and wait for the container to finish.
+// If the image is prebuilt, the build is skipped.
+// The container and the image built here are removed before returning.
+// If the build fails, the build log is returned as stderr.
+// on_run is called when the container is started.
+func (e *Executer) run_container(ctx context.Context, conf CheckerConfig, on_run func()) (containerRun, error) {
+	run := containerRun{exit_code: -1}
+	chall := e.chall
+	image_name := e.image
+	if image_name == "" {
+		image_name = e.image_name()
+	}
+	container_name := e.container_name()
+	labels := e.labels()
+
+	config := &container.Config{
+		Image:  image_name,
+		Cmd:    []string{chall.target.Host, strconv.Itoa(chall.target.Port)},
+		Labels: labels,
+	}
+	host_config := &container.HostConfig{}
+	if err := apply_extra_docker_arg(conf.ExtraDockerArg, config, host_config); err != nil {
+		return run, err
+	}
+
+	// build unless the image is prebuilt
+	if e.image == "" {
+		build_started := time.Now()
+		build_log, err := build_image(ctx, e.docker, chall.SolverDir, image_name, labels)
+		run.build_time = time.Since(build_started)
+		defer e.remove_image(image_name)
+		if err != nil {
+			run.stderr = build_log
+			return run, err
+		}
+	}
+
+	// create
+	created, err := e.docker.ContainerCreate(ctx, config, host_config, nil, nil, container_name)
+	if err != nil {
+		return run, &DockerError{StepCreate, err}
+	}
+	defer e.remove_container(created.ID)
+
+	// start
+	run_started := time.Now()
+	if err := e.docker.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}); err != nil {
+		return run, &DockerError{StepStart, err}
+	}
+	e.logger.Infof("[%s] Test started in %s.", chall.Name, container_name)
+	on_run()
+
+	// wait
+	wait_chan, err_chan := e.docker.ContainerWait(ctx, created.ID, container.WaitConditionNotRunning)
+	select {
+	case res := <-wait_chan:
+		if res.Error != nil {
+			err = &DockerError{StepWait, errors.New(res.Error.Message)}
 		}
-		break
+		run.exit_code = res.StatusCode
+	case wait_err := <-err_chan:
+		err = &DockerError{StepWait, wait_err}
+	}
+	run.run_time = time.Since(run_started)
+
+	run.stdout, run.stderr = e.fetch_logs(created.ID)
+	return run, err
+}
+
+// Fetch stdout and stderr of a container.
+// This works even after the test is cancelled.
+func (e *Executer) fetch_logs(container_id string) (string, string) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+
+	var outbuf bytes.Buffer
+	var errbuf bytes.Buffer
+	logs, err := e.docker.ContainerLogs(ctx, container_id, types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true})
+	if err != nil {
+		e.logger.Warnf("[%s] Failed to fetch logs: %v", e.chall.Name, err)
+		return "", ""
+	}
+	defer logs.Close()
+	if _, err := stdcopy.StdCopy(&outbuf, &errbuf, logs); err != nil {
+		e.logger.Warnf("[%s] Failed to fetch logs: %v", e.chall.Name, err)
+	}
+	return outbuf.String(), errbuf.String()
+}
+
+// Remove a container, killing it if it is still running.
+func (e *Executer) remove_container(container_id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+
+	if err := e.docker.ContainerRemove(ctx, container_id, types.ContainerRemoveOptions{Force: true}); err != nil {
+		e.logger.Errorf("[%s] %v", e.chall.Name, &DockerError{StepRemove, err})
+	}
+}
+
+// Remove the image tagged uniquely for this test.
+// Layers are kept in the build cache.
+func (e *Executer) remove_image(image_name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+
+	if _, err := e.docker.ImageRemove(ctx, image_name, types.ImageRemoveOptions{}); err != nil {
+		e.logger.Debugf("[%s] %v", e.chall.Name, &DockerError{StepRemove, err})
 	}
 }
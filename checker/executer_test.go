@@ -1,11 +1,135 @@
 package checker
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
-	"syscall"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
+// Fake Docker Engine for unit tests.
+type fakeDocker struct {
+	build_error string // error message reported in the build stream
+	exit_code   int64
+	block       bool // container keeps running until the context is cancelled
+	block_build bool // build keeps running until the context is cancelled
+	create_err  error
+	stdout      string
+	stderr      string
+
+	mu                 sync.Mutex
+	num_builds         int
+	built_images       []string
+	created_containers []*container.Config
+	removed_containers []string
+	removed_images     []string
+}
+
+func (f *fakeDocker) ImageBuild(ctx context.Context, build_ctx io.Reader, options types.ImageBuildOptions) (types.ImageBuildResponse, error) {
+	io.Copy(io.Discard, build_ctx)
+	if f.block_build {
+		<-ctx.Done()
+		return types.ImageBuildResponse{}, ctx.Err()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.num_builds++
+
+	body := `{"stream":"Step 1/1 : FROM scratch\n"}` + "\n"
+	if f.build_error != "" {
+		body += fmt.Sprintf(`{"errorDetail":{"message":%q},"error":%q}`, f.build_error, f.build_error) + "\n"
+	} else {
+		f.built_images = append(f.built_images, options.Tags...)
+	}
+	return types.ImageBuildResponse{Body: io.NopCloser(strings.NewReader(body))}, nil
+}
+
+func (f *fakeDocker) ImageRemove(ctx context.Context, image_id string, options types.ImageRemoveOptions) ([]types.ImageDeleteResponseItem, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.removed_images = append(f.removed_images, image_id)
+	return nil, nil
+}
+
+func (f *fakeDocker) ImageInspectWithRaw(ctx context.Context, image_id string) (types.ImageInspect, []byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, image := range f.built_images {
+		if image == image_id {
+			return types.ImageInspect{ID: image_id}, nil, nil
+		}
+	}
+	return types.ImageInspect{}, nil, errdefs.NotFound(fmt.Errorf("No such image: %s", image_id))
+}
+
+func (f *fakeDocker) ImageList(ctx context.Context, options types.ImageListOptions) ([]types.ImageSummary, error) {
+	return nil, nil
+}
+
+func (f *fakeDocker) ContainerCreate(ctx context.Context, config *container.Config, host_config *container.HostConfig, networking_config *network.NetworkingConfig, platform *ocispec.Platform, name string) (container.CreateResponse, error) {
+	if f.create_err != nil {
+		return container.CreateResponse{}, f.create_err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.created_containers = append(f.created_containers, config)
+	return container.CreateResponse{ID: name}, nil
+}
+
+func (f *fakeDocker) ContainerStart(ctx context.Context, container_id string, options types.ContainerStartOptions) error {
+	return nil
+}
+
+func (f *fakeDocker) ContainerWait(ctx context.Context, container_id string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error) {
+	res_chan := make(chan container.WaitResponse, 1)
+	err_chan := make(chan error, 1)
+	if f.block {
+		go func() {
+			<-ctx.Done()
+			err_chan <- ctx.Err()
+		}()
+	} else {
+		res_chan <- container.WaitResponse{StatusCode: f.exit_code}
+	}
+	return res_chan, err_chan
+}
+
+func (f *fakeDocker) ContainerLogs(ctx context.Context, container_id string, options types.ContainerLogsOptions) (io.ReadCloser, error) {
+	var buf bytes.Buffer
+	stdcopy.NewStdWriter(&buf, stdcopy.Stdout).Write([]byte(f.stdout))
+	stdcopy.NewStdWriter(&buf, stdcopy.Stderr).Write([]byte(f.stderr))
+	return io.NopCloser(&buf), nil
+}
+
+func (f *fakeDocker) ContainerRemove(ctx context.Context, container_id string, options types.ContainerRemoveOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.removed_containers = append(f.removed_containers, container_id)
+	return nil
+}
+
+func (f *fakeDocker) ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	return nil, nil
+}
+
+func (f *fakeDocker) Close() error {
+	return nil
+}
+
 func TestExecuter_ExecuteDockerTest(t *testing.T) {
 	cwd := testing_cd_root(t)
 	defer os.Chdir(cwd)
@@ -15,15 +139,19 @@ func TestExecuter_ExecuteDockerTest(t *testing.T) {
 	}
 	type args struct {
 		res_chan        chan TestResultMessage
-		killer_chan     chan bool
 		expected_result TestResult
-		// Send kill signal using channel
+		// Cancel the test as timeout
 		should_kill bool
-		// Send SIGTERM to myself
-		should_interrupt_myself bool
+		// Cancel the test cycle
+		should_interrupt bool
 	}
 
 	logger := create_logger()
+	docker, err := NewDockerClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer docker.Close()
 
 	tests := []struct {
 		name   string
@@ -36,11 +164,10 @@ func TestExecuter_ExecuteDockerTest(t *testing.T) {
 				challenge_dir: "tests/assets/challs/just-success",
 			},
 			args: args{
-				res_chan:                make(chan TestResultMessage),
-				killer_chan:             make(chan bool),
-				expected_result:         ResultSuccess,
-				should_kill:             false,
-				should_interrupt_myself: false,
+				res_chan:         make(chan TestResultMessage),
+				expected_result:  ResultSuccess,
+				should_kill:      false,
+				should_interrupt: false,
 			},
 		},
 		{
@@ -49,11 +176,10 @@ func TestExecuter_ExecuteDockerTest(t *testing.T) {
 				challenge_dir: "tests/assets/challs/just-fail",
 			},
 			args: args{
-				res_chan:                make(chan TestResultMessage),
-				killer_chan:             make(chan bool),
-				expected_result:         ResultFailure,
-				should_kill:             false,
-				should_interrupt_myself: false,
+				res_chan:         make(chan TestResultMessage),
+				expected_result:  ResultFailure,
+				should_kill:      false,
+				should_interrupt: false,
 			},
 		},
 		{
@@ -62,11 +188,10 @@ func TestExecuter_ExecuteDockerTest(t *testing.T) {
 				challenge_dir: "tests/assets/challs/just-success-long",
 			},
 			args: args{
-				res_chan:                make(chan TestResultMessage),
-				killer_chan:             make(chan bool),
-				expected_result:         ResultTimeout,
-				should_kill:             true,
-				should_interrupt_myself: false,
+				res_chan:         make(chan TestResultMessage),
+				expected_result:  ResultTimeout,
+				should_kill:      true,
+				should_interrupt: false,
 			},
 		},
 		{
@@ -75,11 +200,10 @@ func TestExecuter_ExecuteDockerTest(t *testing.T) {
 				challenge_dir: "tests/assets/challs/just-success-long",
 			},
 			args: args{
-				res_chan:                make(chan TestResultMessage),
-				killer_chan:             make(chan bool),
-				expected_result:         ResultTestInterrupted,
-				should_kill:             false,
-				should_interrupt_myself: true,
+				res_chan:         make(chan TestResultMessage),
+				expected_result:  ResultTestInterrupted,
+				should_kill:      false,
+				should_interrupt: true,
 			},
 		},
 	}
@@ -112,16 +236,21 @@ func TestExecuter_ExecuteDockerTest(t *testing.T) {
 				challenge_dir: tt.fields.challenge_dir,
 				chall:         chall,
 				logger:        logger,
+				attempt:       1,
+				run_id:        new_run_id(),
+				docker:        docker,
 			}
-			go e.ExecuteDockerTest(tt.args.res_chan, tt.args.killer_chan, CheckerConfig{})
+			ctx, cancel := context.WithCancelCause(context.Background())
+			defer cancel(nil)
+			go e.ExecuteDockerTest(ctx, tt.args.res_chan, CheckerConfig{})
 
 			var res TestResultMessage
 			if tt.args.should_kill {
-				close(tt.args.killer_chan)
+				cancel(errTestTimeout)
 			}
-			if tt.args.should_interrupt_myself {
+			if tt.args.should_interrupt {
 				res = <-tt.args.res_chan // wait RESULT_RUNNING
-				syscall.Kill(os.Getpid(), syscall.SIGTERM)
+				cancel(nil)
 			}
 
 			for {
@@ -136,3 +265,234 @@ func TestExecuter_ExecuteDockerTest(t *testing.T) {
 		})
 	}
 }
+
+func TestExecuter_FakeDocker(t *testing.T) {
+	logger := create_logger()
+	solver_dir := t.TempDir()
+	if err := os.WriteFile(solver_dir+"/Dockerfile", []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	chall := Challenge{
+		Name:      "fake",
+		SolverDir: solver_dir,
+		target:    Target{ChallengeName: "fake", Host: "localhost", Port: 1337},
+	}
+
+	tests := []struct {
+		name            string
+		docker          *fakeDocker
+		should_kill     bool // cancel as timeout
+		should_cancel   bool // cancel by the caller
+		expected_result TestResult
+		expected_stdout string
+		expected_phase  TestPhase
+		expected_exit   int
+		image           string
+	}{
+		{
+			name:            "success",
+			docker:          &fakeDocker{exit_code: 0, stdout: "OK"},
+			expected_result: ResultSuccess,
+			expected_stdout: "OK",
+		},
+		{
+			name:            "exploit-failure",
+			docker:          &fakeDocker{exit_code: 1, stdout: "NG"},
+			expected_result: ResultFailure,
+			expected_stdout: "NG",
+			expected_exit:   1,
+		},
+		{
+			name:            "build-failure",
+			docker:          &fakeDocker{build_error: "The command '/bin/sh -c apt-get install -y python2' returned a non-zero code: 100"},
+			expected_result: ResultBuildFailure,
+			expected_exit:   -1,
+		},
+		{
+			name:            "missing-base-image",
+			docker:          &fakeDocker{build_error: "pull access denied for ubuntuu, repository does not exist or may require 'docker login'"},
+			expected_result: ResultBuildFailure,
+			expected_exit:   -1,
+		},
+		{
+			name:            "registry-outage",
+			docker:          &fakeDocker{build_error: "toomanyrequests: You have reached your pull rate limit."},
+			expected_result: ResultInfraError,
+			expected_exit:   -1,
+		},
+		{
+			name:            "timeout",
+			docker:          &fakeDocker{block: true, stdout: "sleeping"},
+			should_kill:     true,
+			expected_result: ResultTimeout,
+			expected_stdout: "sleeping",
+			expected_phase:  PhaseRun,
+			expected_exit:   -1,
+		},
+		{
+			name:            "interrupt",
+			docker:          &fakeDocker{block: true},
+			should_cancel:   true,
+			expected_result: ResultTestInterrupted,
+			expected_exit:   -1,
+		},
+		{
+			name:            "prebuilt",
+			docker:          &fakeDocker{exit_code: 1},
+			image:           "solver_fake:0123456789ab",
+			expected_result: ResultFailure,
+			expected_exit:   1,
+		},
+		{
+			name:            "build-timeout",
+			docker:          &fakeDocker{block_build: true},
+			should_kill:     true,
+			expected_result: ResultTimeout,
+			expected_phase:  PhaseBuild,
+			expected_exit:   -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Executer{
+				challenge_dir: solver_dir,
+				chall:         chall,
+				logger:        logger,
+				attempt:       1,
+				run_id:        new_run_id(),
+				docker:        tt.docker,
+				image:         tt.image,
+			}
+			ctx, cancel := context.WithCancelCause(context.Background())
+			defer cancel(nil)
+			res_chan := make(chan TestResultMessage)
+			go e.ExecuteDockerTest(ctx, res_chan, CheckerConfig{})
+
+			first_phase := PhaseBuild
+			if tt.image != "" {
+				first_phase = PhaseRun
+			}
+			res := <-res_chan
+			if res.Result != ResultRunning || res.Phase != first_phase {
+				t.Fatalf("Expected result %d in %s phase, got %d in %s phase", ResultRunning, first_phase, res.Result, res.Phase)
+			}
+			if tt.should_kill {
+				time.Sleep(10 * time.Millisecond)
+				cancel(errTestTimeout)
+			}
+			if tt.should_cancel {
+				time.Sleep(10 * time.Millisecond)
+				cancel(nil)
+			}
+			for res.Result == ResultRunning {
+				res = <-res_chan
+			}
+
+			if res.Result != tt.expected_result {
+				t.Errorf("Expected result %d, got %d (%s)", tt.expected_result, res.Result, res.Errlog)
+			}
+			if tt.expected_result == ResultTimeout && res.Phase != tt.expected_phase {
+				t.Errorf("Expected timeout in %s phase, got %s", tt.expected_phase, res.Phase)
+			}
+			if res.ExitCode != tt.expected_exit {
+				t.Errorf("Expected exit code %d, got %d", tt.expected_exit, res.ExitCode)
+			}
+			if tt.expected_exit >= 0 && tt.image == "" && res.BuildTime == 0 {
+				t.Errorf("Expected non-zero build time")
+			}
+			if tt.expected_stdout != "" && res.Stdout != tt.expected_stdout {
+				t.Errorf("Expected stdout %q, got %q", tt.expected_stdout, res.Stdout)
+			}
+
+			tt.docker.mu.Lock()
+			defer tt.docker.mu.Unlock()
+			if len(tt.docker.created_containers) != len(tt.docker.removed_containers) {
+				t.Errorf("%d containers created, but %d removed", len(tt.docker.created_containers), len(tt.docker.removed_containers))
+			}
+			for _, config := range tt.docker.created_containers {
+				if len(config.Cmd) != 2 || config.Cmd[0] != "localhost" || config.Cmd[1] != "1337" {
+					t.Errorf("Unexpected command: %v", config.Cmd)
+				}
+			}
+			if tt.image != "" && (tt.docker.num_builds != 0 || len(tt.docker.removed_images) != 0) {
+				t.Errorf("Prebuilt image must not be built nor removed")
+			}
+			for _, image := range tt.docker.built_images {
+				if !slices.Contains(tt.docker.removed_images, image) {
+					t.Errorf("Image %s built, but not removed", image)
+				}
+			}
+		})
+	}
+}
+
+func TestExecuter_ErrorClassification(t *testing.T) {
+	logger := create_logger()
+	solver_dir := t.TempDir()
+	if err := os.WriteFile(solver_dir+"/Dockerfile", []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	chall := Challenge{
+		Name:      "fake",
+		SolverDir: solver_dir,
+		target:    Target{ChallengeName: "fake", Host: "localhost", Port: 1337},
+	}
+
+	tests := []struct {
+		name            string
+		docker          *fakeDocker
+		extra_arg       string
+		expected_result TestResult
+		should_retry    bool
+	}{
+		{
+			name:            "daemon-error",
+			docker:          &fakeDocker{create_err: errors.New("Cannot connect to the Docker daemon")},
+			expected_result: ResultInfraError,
+			should_retry:    true,
+		},
+		{
+			name:            "build-error",
+			docker:          &fakeDocker{build_error: "COPY failed: file not found"},
+			expected_result: ResultBuildFailure,
+		},
+		{
+			// errors of the configuration are neither troubles of Docker nor retried
+			name:            "bad-extra-arg",
+			docker:          &fakeDocker{},
+			extra_arg:       "--device /dev/fuse",
+			expected_result: ResultExecutionFailure,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Executer{
+				challenge_dir: solver_dir,
+				chall:         chall,
+				logger:        logger,
+				attempt:       1,
+				run_id:        new_run_id(),
+				docker:        tt.docker,
+			}
+			res_chan := make(chan TestResultMessage)
+			go e.ExecuteDockerTest(context.Background(), res_chan, CheckerConfig{ExtraDockerArg: tt.extra_arg})
+
+			res := <-res_chan
+			for res.Result == ResultRunning {
+				res = <-res_chan
+			}
+			if res.Result != tt.expected_result {
+				t.Errorf("Expected result %d, got %d (%s)", tt.expected_result, res.Result, res.Errlog)
+			}
+			conf := CheckerConfig{Retries: 1}
+			if got := should_retry(conf, res.Result, 1); got != tt.should_retry {
+				t.Errorf("should_retry() = %v, want %v", got, tt.should_retry)
+			}
+			if tt.extra_arg != "" && tt.docker.num_builds != 0 {
+				t.Errorf("Image must not be built with an invalid configuration")
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package checker
+
+// This file implements the policy which decides the exit code of the checker from a report,
+// so that the checker can be used as a gate before deploying challenges.
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Exit codes of cmd/checker.
+const (
+	ExitOK = 0
+	// the checker itself failed, eg: broken configuration or database error
+	ExitError = 1
+	// challenges are unsolvable according to the exit policy
+	ExitUnsolvable = 3
+	// challenges could not be tested due to troubles of Docker daemon or registry
+	ExitInfraError = 4
+	// the test cycle was interrupted before all challenges were tested
+	ExitInterrupted = 5
+)
+
+// Policy to decide the exit code from the results of a test cycle.
+type ExitPolicy struct {
+	// "never" (default), "any" or "fraction"
+	FailOn string
+	// only these genres and challenges are considered. All challenges are considered if both are empty.
+	Genres     []string
+	Challenges []string
+	// with "fraction", the checker fails if more than this fraction of the considered challenges are unsolvable
+	Fraction float64
+}
+
+// Create an exit policy from the configuration.
+func NewExitPolicy(conf CheckerConfig) (ExitPolicy, error) {
+	policy := ExitPolicy{
+		FailOn:     conf.FailOn,
+		Genres:     conf.FailGenres,
+		Challenges: conf.FailChalls,
+		Fraction:   conf.FailFraction,
+	}
+	switch policy.FailOn {
+	case "":
+		policy.FailOn = "never"
+	case "never", "any":
+	case "fraction":
+		if policy.Fraction < 0 || policy.Fraction >= 1 {
+			return policy, fmt.Errorf("Invalid fail_fraction: %v (must be in [0, 1))", policy.Fraction)
+		}
+	default:
+		return policy, fmt.Errorf("Unknown fail_on: %s", policy.FailOn)
+	}
+	return policy, nil
+}
+
+func (p ExitPolicy) considers(c ChallengeReport) bool {
+	if len(p.Genres) == 0 && len(p.Challenges) == 0 {
+		return true
+	}
+	return slices.Contains(p.Genres, c.Genre) || slices.Contains(p.Challenges, c.Name)
+}
+
+// Decide the exit code from a report, with the reason if it is not ExitOK.
+// Unsolvable challenges take priority over infrastructure errors, which take priority over interruption,
+// because challenges which could not be tested might be solvable.
+func (p ExitPolicy) ExitCode(report *Report) (int, string) {
+	if p.FailOn == "never" || p.FailOn == "" {
+		return ExitOK, ""
+	}
+
+	unsolvable := make([]string, 0)
+	infra_error := make([]string, 0)
+	interrupted := make([]string, 0)
+	num_considered := 0
+	for _, c := range report.Challenges {
+		// challenges under maintenance are not expected to be solvable
+		if !p.considers(c) || c.Result == ResultMaintenance {
+			continue
+		}
+		num_considered++
+		switch {
+		case c.Result.unsolvable():
+			unsolvable = append(unsolvable, c.Name)
+		case c.Result == ResultTestInterrupted:
+			interrupted = append(interrupted, c.Name)
+		case c.Result != ResultSuccess:
+			infra_error = append(infra_error, c.Name)
+		}
+	}
+
+	if len(unsolvable) > 0 {
+		switch p.FailOn {
+		case "any":
+			return ExitUnsolvable, fmt.Sprintf("Unsolvable challenges: %s", strings.Join(unsolvable, ", "))
+		case "fraction":
+			fraction := float64(len(unsolvable)) / float64(num_considered)
+			if fraction > p.Fraction {
+				return ExitUnsolvable, fmt.Sprintf("%d of %d challenges are unsolvable (more than %.0f%%): %s", len(unsolvable), num_considered, p.Fraction*100, strings.Join(unsolvable, ", "))
+			}
+		}
+	}
+	if len(infra_error) > 0 {
+		return ExitInfraError, fmt.Sprintf("Challenges not tested due to checker errors: %s", strings.Join(infra_error, ", "))
+	}
+	if len(interrupted) > 0 {
+		return ExitInterrupted, fmt.Sprintf("Challenges not tested due to interruption: %s", strings.Join(interrupted, ", "))
+	}
+	return ExitOK, ""
+}
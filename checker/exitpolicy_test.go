@@ -0,0 +1,88 @@
+package checker
+
+import (
+	"testing"
+	"time"
+)
+
+func test_policy_report() *Report {
+	challs := []Challenge{
+		{Name: "pwn-ok", Genre: "pwn"},
+		{Name: "pwn-broken", Genre: "pwn"},
+		{Name: "web-ok", Genre: "web"},
+		{Name: "web-docker", Genre: "web"},
+		{Name: "web-redeploying", Genre: "web"},
+	}
+	report := new_report("0123456789abcdef", challs)
+	report.record(challs[0], TestResultMessage{Result: ResultSuccess, Phase: PhaseRun, RunTime: time.Second}, 1)
+	report.record(challs[1], TestResultMessage{Result: ResultFailure, Phase: PhaseRun, ExitCode: 1, RunTime: time.Second}, 1)
+	report.record(challs[2], TestResultMessage{Result: ResultSuccess, Phase: PhaseRun, RunTime: time.Second}, 1)
+	report.record(challs[3], TestResultMessage{Result: ResultInfraError, Phase: PhaseBuild, ExitCode: -1}, 1)
+	report.record(challs[4], TestResultMessage{Result: ResultMaintenance, Phase: PhaseBuild, ExitCode: -1}, 0)
+	return report
+}
+
+func TestExitPolicy_NewExitPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    CheckerConfig
+		want    string
+		wantErr bool
+	}{
+		{name: "default", conf: CheckerConfig{}, want: "never"},
+		{name: "any", conf: CheckerConfig{FailOn: "any"}, want: "any"},
+		{name: "fraction", conf: CheckerConfig{FailOn: "fraction", FailFraction: 0.5}, want: "fraction"},
+		{name: "invalid-fraction", conf: CheckerConfig{FailOn: "fraction", FailFraction: 1}, wantErr: true},
+		{name: "unknown", conf: CheckerConfig{FailOn: "sometimes"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewExitPolicy(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewExitPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.FailOn != tt.want {
+				t.Errorf("NewExitPolicy() got = %s, want %s", got.FailOn, tt.want)
+			}
+		})
+	}
+}
+
+func TestExitPolicy_ExitCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy ExitPolicy
+		want   int
+	}{
+		{name: "never", policy: ExitPolicy{FailOn: "never"}, want: ExitOK},
+		{name: "any", policy: ExitPolicy{FailOn: "any"}, want: ExitUnsolvable},
+		{name: "genre-unsolvable", policy: ExitPolicy{FailOn: "any", Genres: []string{"pwn"}}, want: ExitUnsolvable},
+		{name: "genre-infra-error", policy: ExitPolicy{FailOn: "any", Genres: []string{"web"}}, want: ExitInfraError},
+		{name: "challenge", policy: ExitPolicy{FailOn: "any", Challenges: []string{"pwn-ok", "web-ok"}}, want: ExitOK},
+		{name: "maintenance", policy: ExitPolicy{FailOn: "any", Challenges: []string{"pwn-ok", "web-redeploying"}}, want: ExitOK},
+		{name: "fraction-exceeded", policy: ExitPolicy{FailOn: "fraction", Fraction: 0.2}, want: ExitUnsolvable},
+		{name: "fraction-within", policy: ExitPolicy{FailOn: "fraction", Fraction: 0.25}, want: ExitInfraError},
+	}
+
+	report := test_policy_report()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := tt.policy.ExitCode(report)
+			if got != tt.want {
+				t.Errorf("ExitCode() got = %d (%s), want %d", got, reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestExitPolicy_Interrupted(t *testing.T) {
+	challs := []Challenge{{Name: "solvable"}, {Name: "not-tested"}}
+	report := new_report("0123456789abcdef", challs)
+	report.record(challs[0], TestResultMessage{Result: ResultSuccess, Phase: PhaseRun}, 1)
+
+	got, _ := ExitPolicy{FailOn: "any"}.ExitCode(report)
+	if got != ExitInterrupted {
+		t.Errorf("ExitCode() got = %d, want %d", got, ExitInterrupted)
+	}
+}
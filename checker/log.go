@@ -0,0 +1,47 @@
+package checker
+
+// This file looks up logs of tests for operators.
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Results whose logs are looked up by default.
+var failedResults = []TestResult{ResultTimeout, ResultExecutionFailure, ResultFailure, ResultBuildFailure, ResultInfraError}
+
+// Find the log of the final attempt of a challenge in the test cycle `run_id`.
+// If `run_id` is empty, the log of the last failed attempt is returned.
+func FindLog(store ResultStore, chall_name string, run_id string) (DbLog, error) {
+	if run_id == "" {
+		last, err := store.FetchLastResultIn(chall_name, failedResults)
+		if errors.Is(err, sql.ErrNoRows) {
+			return DbLog{}, fmt.Errorf("No failed tests of %s", chall_name)
+		}
+		if err != nil {
+			return DbLog{}, err
+		}
+		return store.FetchLog(chall_name, last.RunID, last.Attempt)
+	}
+
+	// attempts are numbered from 1, except 0 of maintenance
+	var found *DbLog
+	for attempt := uint(0); ; attempt++ {
+		log, err := store.FetchLog(chall_name, run_id, attempt)
+		if errors.Is(err, sql.ErrNoRows) {
+			if attempt == 0 {
+				continue
+			}
+			break
+		}
+		if err != nil {
+			return DbLog{}, err
+		}
+		found = &log
+	}
+	if found == nil {
+		return DbLog{}, fmt.Errorf("No logs of %s in test cycle %s", chall_name, run_id)
+	}
+	return *found, nil
+}
@@ -0,0 +1,54 @@
+package checker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLog_FindLog(t *testing.T) {
+	store := create_sqlite_store(t)
+	chall := Challenge{Name: "test"}
+	base := time.Date(2023, 10, 15, 12, 0, 0, 0, time.UTC)
+
+	results := []struct {
+		run_id  string
+		attempt uint
+		result  TestResult
+		stdout  string
+	}{
+		{"run0", 1, ResultFailure, "failed 0-1"},
+		{"run0", 2, ResultTimeout, "failed 0-2"},
+		{"run1", 1, ResultSuccess, "solved 1-1"},
+	}
+	for i, r := range results {
+		res := TestResultMessage{Result: r.result, Stdout: r.stdout, Timestamp: base.Add(time.Duration(i) * time.Minute)}
+		if err := store.RecordResult(chall, res, r.run_id, r.attempt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		chall   string
+		run_id  string
+		want    string
+		wantErr bool
+	}{
+		{"last-failure", "test", "", "failed 0-2", false},
+		{"final-attempt", "test", "run0", "failed 0-2", false},
+		{"success", "test", "run1", "solved 1-1", false},
+		{"unknown-run", "test", "run2", "", true},
+		{"no-failure", "other", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, err := FindLog(store, tt.chall, tt.run_id)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FindLog() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if log.Stdout != tt.want {
+				t.Errorf("FindLog() stdout = %q, want %q", log.Stdout, tt.want)
+			}
+		})
+	}
+}
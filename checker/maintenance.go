@@ -0,0 +1,113 @@
+package checker
+
+// This file implements maintenance windows, in which tests of challenges are skipped and recorded as ResultMaintenance,
+// and notifications of the challenges are suppressed. eg: while a challenge is redeployed.
+// Windows are read from `maintenance_file` and the `maintenance_window` table, which is edited by the API of the badge server.
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// A period of maintenance of a challenge or all challenges of a genre.
+type MaintenanceWindow struct {
+	ID        int64     `db:"id" json:"id"`               // 0 for windows of the maintenance file
+	Challenge string    `db:"challenge" json:"challenge"` // "" to cover all challenges of Genre
+	Genre     string    `db:"genre" json:"genre"`
+	Start     time.Time `db:"start_at" json:"start"`
+	End       time.Time `db:"end_at" json:"end"`
+	Reason    string    `db:"reason" json:"reason"`
+}
+
+func (w MaintenanceWindow) Validate() error {
+	if w.Challenge == "" && w.Genre == "" {
+		return fmt.Errorf("Maintenance window requires challenge or genre")
+	}
+	if w.End.IsZero() {
+		return fmt.Errorf("Maintenance window requires end")
+	}
+	if !w.Start.Before(w.End) {
+		return fmt.Errorf("Maintenance window must start before its end")
+	}
+	return nil
+}
+
+// Check if the window covers a challenge at time t.
+// The challenge is covered if its name matches, or if the window has no challenge and its genre matches.
+func (w MaintenanceWindow) Covers(chall Challenge, t time.Time) bool {
+	if t.Before(w.Start) || !t.Before(w.End) {
+		return false
+	}
+	if w.Challenge != "" {
+		return w.Challenge == chall.Name
+	}
+	return w.Genre == chall.Genre
+}
+
+// Read maintenance windows from a JSON file of a list of windows, eg:
+// [{"challenge": "pwn-1", "start": "2023-11-04T10:00:00+09:00", "end": "2023-11-04T11:00:00+09:00", "reason": "redeploy"}]
+func ReadMaintenanceFile(path string) ([]MaintenanceWindow, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	windows := make([]MaintenanceWindow, 0)
+	if err := json.Unmarshal(data, &windows); err != nil {
+		return nil, err
+	}
+	for i, w := range windows {
+		if err := w.Validate(); err != nil {
+			return nil, fmt.Errorf("%s[%d]: %v", path, i, err)
+		}
+		windows[i].ID = 0
+	}
+	return windows, nil
+}
+
+// Load maintenance windows which are not over at `now` from the maintenance file and the store.
+// Failures are logged, and windows of the other source are still used.
+func load_maintenance(logger *zap.SugaredLogger, conf CheckerConfig, store ResultStore, now time.Time) []MaintenanceWindow {
+	windows := make([]MaintenanceWindow, 0)
+	if conf.MaintenanceFile != "" {
+		file_windows, err := ReadMaintenanceFile(conf.MaintenanceFile)
+		if err != nil {
+			logger.Errorw("Failed to read maintenance file", "file", conf.MaintenanceFile, "error", err)
+		}
+		for _, w := range file_windows {
+			if w.End.After(now) {
+				windows = append(windows, w)
+			}
+		}
+	}
+	if store != nil {
+		db_windows, err := store.FetchMaintenanceWindows(now)
+		if err != nil {
+			logger.Errorw("Failed to fetch maintenance windows", "error", err)
+		}
+		windows = append(windows, db_windows...)
+	}
+	return windows
+}
+
+// Find a maintenance window covering a challenge at time t.
+func find_maintenance(windows []MaintenanceWindow, chall Challenge, t time.Time) (MaintenanceWindow, bool) {
+	for _, w := range windows {
+		if w.Covers(chall, t) {
+			return w, true
+		}
+	}
+	return MaintenanceWindow{}, false
+}
+
+// Message recorded as stdout of a test skipped by a maintenance window.
+func (w MaintenanceWindow) message() string {
+	msg := fmt.Sprintf("Skipped by maintenance window until %s", w.End.UTC().Format(time.RFC3339))
+	if w.Reason != "" {
+		msg += ": " + w.Reason
+	}
+	return msg
+}
@@ -0,0 +1,171 @@
+package checker
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMaintenance_Covers(t *testing.T) {
+	base := time.Date(2023, 11, 4, 10, 0, 0, 0, time.UTC)
+	chall := Challenge{Name: "pwn-1", Genre: "pwn"}
+
+	tests := []struct {
+		name   string
+		window MaintenanceWindow
+		at     time.Time
+		want   bool
+	}{
+		{"challenge", MaintenanceWindow{Challenge: "pwn-1", Start: base, End: base.Add(time.Hour)}, base, true},
+		{"other-challenge", MaintenanceWindow{Challenge: "pwn-2", Genre: "pwn", Start: base, End: base.Add(time.Hour)}, base, false},
+		{"genre", MaintenanceWindow{Genre: "pwn", Start: base, End: base.Add(time.Hour)}, base.Add(30 * time.Minute), true},
+		{"other-genre", MaintenanceWindow{Genre: "web", Start: base, End: base.Add(time.Hour)}, base, false},
+		{"before", MaintenanceWindow{Challenge: "pwn-1", Start: base, End: base.Add(time.Hour)}, base.Add(-time.Second), false},
+		{"end", MaintenanceWindow{Challenge: "pwn-1", Start: base, End: base.Add(time.Hour)}, base.Add(time.Hour), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.window.Covers(chall, tt.at); got != tt.want {
+				t.Errorf("Covers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaintenance_ReadMaintenanceFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "maintenance.json")
+	content := `[{"challenge": "pwn-1", "start": "2023-11-04T10:00:00+09:00", "end": "2023-11-04T11:00:00+09:00", "reason": "redeploy"}, {"id": 42, "genre": "web", "end": "2023-11-05T00:00:00Z"}]`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	windows, err := ReadMaintenanceFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 2 || windows[0].Reason != "redeploy" || !windows[0].End.Equal(time.Date(2023, 11, 4, 2, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected windows: %+v", windows)
+	}
+	// IDs are only given to windows in DB
+	if windows[1].ID != 0 || windows[1].Genre != "web" {
+		t.Errorf("Unexpected window: %+v", windows[1])
+	}
+
+	for _, invalid := range []string{
+		`[{"start": "2023-11-04T10:00:00Z", "end": "2023-11-04T11:00:00Z"}]`,
+		`[{"challenge": "pwn-1", "start": "2023-11-04T10:00:00Z"}]`,
+		`[{"challenge": "pwn-1", "start": "2023-11-04T10:00:00Z", "end": "2023-11-04T09:00:00Z"}]`,
+	} {
+		if err := os.WriteFile(path, []byte(invalid), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadMaintenanceFile(path); err == nil {
+			t.Errorf("Expected error for %s", invalid)
+		}
+	}
+}
+
+func TestMaintenance_Store(t *testing.T) {
+	store := create_sqlite_store(t)
+	base := time.Date(2023, 11, 4, 10, 0, 0, 0, time.UTC)
+
+	ids := make([]int64, 0)
+	for i, name := range []string{"pwn-1", "pwn-2", "pwn-3"} {
+		window := MaintenanceWindow{Challenge: name, Start: base.Add(time.Duration(i) * time.Hour), End: base.Add(time.Duration(i+1) * time.Hour), Reason: fmt.Sprintf("reason %d", i)}
+		id, err := store.RecordMaintenanceWindow(window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if ids[0] == ids[1] || ids[1] == ids[2] {
+		t.Fatalf("IDs must be unique: %v", ids)
+	}
+
+	// windows which are over are excluded
+	windows, err := store.FetchMaintenanceWindows(base.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 2 || windows[0].ID != ids[1] || windows[0].Challenge != "pwn-2" || windows[0].Reason != "reason 1" || !windows[0].Start.Equal(base.Add(time.Hour)) {
+		t.Errorf("Unexpected windows: %+v", windows)
+	}
+
+	if err := store.DeleteMaintenanceWindow(ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteMaintenanceWindow(ids[1]); err != sql.ErrNoRows {
+		t.Errorf("DeleteMaintenanceWindow() error = %v, want %v", err, sql.ErrNoRows)
+	}
+	windows, err = store.FetchMaintenanceWindows(base.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 1 || windows[0].ID != ids[2] {
+		t.Errorf("Unexpected windows after deletion: %+v", windows)
+	}
+}
+
+func TestMaintenance_LoadMaintenance(t *testing.T) {
+	store := create_sqlite_store(t)
+	now := time.Date(2023, 11, 4, 10, 0, 0, 0, time.UTC)
+	if _, err := store.RecordMaintenanceWindow(MaintenanceWindow{Genre: "web", Start: now, End: now.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "maintenance.json")
+	content := `[{"challenge": "pwn-1", "start": "2023-11-04T09:00:00Z", "end": "2023-11-04T11:00:00Z"}, {"challenge": "pwn-2", "start": "2023-11-04T08:00:00Z", "end": "2023-11-04T09:00:00Z"}]`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	windows := load_maintenance(create_logger(), CheckerConfig{MaintenanceFile: path}, store, now)
+	if len(windows) != 2 {
+		t.Fatalf("Expected windows of the file and the store, got %+v", windows)
+	}
+	for _, tt := range []struct {
+		chall Challenge
+		want  bool
+	}{
+		{Challenge{Name: "pwn-1", Genre: "pwn"}, true},
+		{Challenge{Name: "pwn-2", Genre: "pwn"}, false},
+		{Challenge{Name: "web-1", Genre: "web"}, true},
+	} {
+		if _, got := find_maintenance(windows, tt.chall, now); got != tt.want {
+			t.Errorf("find_maintenance(%s) = %v, want %v", tt.chall.Name, got, tt.want)
+		}
+	}
+
+	// the store is still used if the file is broken
+	windows = load_maintenance(create_logger(), CheckerConfig{MaintenanceFile: filepath.Join(t.TempDir(), "missing.json")}, store, now)
+	if len(windows) != 1 {
+		t.Errorf("Expected windows of the store, got %+v", windows)
+	}
+}
+
+func TestAlert_Maintenance(t *testing.T) {
+	store := create_sqlite_store(t)
+	tracker := new_alert_tracker(create_logger(), CheckerConfig{}, store)
+	chall := Challenge{Name: "test"}
+	base := time.Date(2023, 10, 15, 12, 0, 0, 0, time.UTC)
+
+	results := []TestResult{ResultFailure, ResultMaintenance, ResultMaintenance, ResultSuccess}
+	want := []string{NotifyAlert, "", "", NotifyRecovery}
+	for i, result := range results {
+		now := base.Add(time.Duration(i) * 5 * time.Minute)
+		run_id := fmt.Sprintf("run%d", i)
+		decision := tracker.decide(chall, result, run_id, now)
+		if decision.kind != want[i] {
+			t.Errorf("decide() of cycle %d got = %q, want %q", i, decision.kind, want[i])
+		}
+		// maintenance is not counted as failed cycles
+		if decision.kind == NotifyRecovery && decision.failures != 1 {
+			t.Errorf("Unexpected failures of the recovery: %d", decision.failures)
+		}
+		if err := store.RecordResult(chall, TestResultMessage{Result: result, Timestamp: now}, run_id, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
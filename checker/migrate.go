@@ -0,0 +1,155 @@
+package checker
+
+// This file implements versioned migrations of the database schema.
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// A step of schema migration.
+// Note that DDL statements of MySQL are committed implicitly,
+// so each step must be safe to re-run if the process dies in the middle of it.
+type migration struct {
+	version     int
+	description string
+	apply       func(ctx context.Context, conn *sqlx.Conn) error
+}
+
+// Differences of SQL databases in schema migrations.
+type dialect struct {
+	// migrations applied in order of their versions
+	migrations []migration
+	// query which returns the number of tables named `schema_version`
+	version_table_query string
+	// column type of timestamps
+	timestamp_type string
+	// serialize migrations of concurrent processes. The returned function releases the lock.
+	lock func(ctx context.Context, conn *sqlx.Conn) (func(), error)
+}
+
+// Schema version required by this checker.
+func (d *dialect) latest_version() int {
+	return d.migrations[len(d.migrations)-1].version
+}
+
+func exec_all(ctx context.Context, conn *sqlx.Conn, queries ...string) error {
+	for _, query := range queries {
+		if _, err := conn.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *dialect) create_version_table(ctx context.Context, conn *sqlx.Conn) error {
+	return exec_all(ctx, conn,
+		"create table if not exists schema_version ("+
+			"version int not null primary key, "+
+			"description varchar(255) not null, "+
+			"applied_at "+d.timestamp_type+" not null"+
+			")",
+	)
+}
+
+func (d *dialect) current_version(ctx context.Context, conn *sqlx.Conn) (int, error) {
+	var count int
+	if err := conn.GetContext(ctx, &count, d.version_table_query); err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, nil
+	}
+
+	var version int
+	if err := conn.GetContext(ctx, &version, "select coalesce(max(version), 0) from schema_version"); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// Schema version required by this checker.
+func (s *SQLStore) LatestSchemaVersion() int {
+	return s.dialect.latest_version()
+}
+
+// Query the version of the database schema. 0 if no migration is applied.
+func (s *SQLStore) CurrentSchemaVersion() (int, error) {
+	ctx := context.Background()
+	conn, err := s.db.Connx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	return s.dialect.current_version(ctx, conn)
+}
+
+// Check if the database schema is up to date.
+// It returns an error if migrations are pending or the schema is newer than this checker.
+func (s *SQLStore) VerifySchema() error {
+	version, err := s.CurrentSchemaVersion()
+	if err != nil {
+		return err
+	}
+	switch latest := s.LatestSchemaVersion(); {
+	case version < latest:
+		return fmt.Errorf("Database schema is at version %d, but version %d is required. Run `migrate` subcommand to apply migrations.", version, latest)
+	case version > latest:
+		return fmt.Errorf("Database schema is at version %d, which is newer than version %d supported by this binary.", version, latest)
+	}
+	return nil
+}
+
+// Apply pending migrations to the database.
+// Concurrent calls from multiple processes are serialized by a lock.
+func (s *SQLStore) Migrate(logger *zap.SugaredLogger) error {
+	ctx := context.Background()
+	// locks belong to a connection, so every query runs on the same one
+	conn, err := s.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	unlock, err := s.dialect.lock(ctx, conn)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := s.dialect.create_version_table(ctx, conn); err != nil {
+		return err
+	}
+	version, err := s.dialect.current_version(ctx, conn)
+	if err != nil {
+		return err
+	}
+	latest := s.LatestSchemaVersion()
+	if version > latest {
+		return fmt.Errorf("Database schema is at version %d, which is newer than version %d supported by this binary.", version, latest)
+	}
+
+	for _, m := range s.dialect.migrations {
+		if m.version <= version {
+			continue
+		}
+		logger.Infof("Applying migration %d: %s", m.version, m.description)
+		if err := m.apply(ctx, conn); err != nil {
+			return fmt.Errorf("Migration %d failed: %v", m.version, err)
+		}
+		query := conn.Rebind("insert into schema_version(version, description, applied_at) values(?, ?, ?)")
+		if _, err := conn.ExecContext(ctx, query, m.version, m.description, time.Now()); err != nil {
+			return err
+		}
+	}
+	if version == latest {
+		logger.Debugf("Database schema is up to date (version %d).", version)
+	}
+
+	return nil
+}
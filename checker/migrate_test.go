@@ -0,0 +1,66 @@
+package checker
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMigrate_Versions(t *testing.T) {
+	dialects := map[string]*dialect{
+		"mysql":    &mysqlDialect,
+		"sqlite":   &sqliteDialect,
+		"postgres": &postgresDialect,
+	}
+	for name, d := range dialects {
+		for i, m := range d.migrations {
+			if m.version != i+1 {
+				t.Errorf("[%s] migrations[%d].version = %d, want %d", name, i, m.version, i+1)
+			}
+			if m.description == "" || m.apply == nil {
+				t.Errorf("[%s] migration %d must have description and apply", name, m.version)
+			}
+		}
+		if d.latest_version() != len(d.migrations) {
+			t.Errorf("[%s] latest_version() = %d, want %d", name, d.latest_version(), len(d.migrations))
+		}
+	}
+}
+
+func TestMigrate_Migrate(t *testing.T) {
+	ctx := context.Background()
+	container, err := setupMysql(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer container.Terminate(ctx)
+
+	// OpenStore migrates the schema of the oldest `init.sql`
+	store, err := container.OpenStore(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.VerifySchema(); err != nil {
+		t.Fatal(err)
+	}
+
+	// migrations are idempotent
+	if err := store.Migrate(create_logger()); err != nil {
+		t.Fatal(err)
+	}
+	version, err := store.CurrentSchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != store.LatestSchemaVersion() {
+		t.Errorf("version = %d, want %d", version, store.LatestSchemaVersion())
+	}
+
+	var count int
+	query := `select count(*) from information_schema.statistics where table_schema = database() and table_name = 'test_result' and index_name = 'idx_test_result_name_timestamp'`
+	if err := store.db.Get(&count, query); err != nil {
+		t.Fatal(err)
+	}
+	if count == 0 {
+		t.Errorf("index on (name, timestamp) of test_result not found")
+	}
+}
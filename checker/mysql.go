@@ -1,73 +1,244 @@
 package checker
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
 	"net"
-	"time"
 
 	"github.com/go-sql-driver/mysql"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
 )
 
-// Schema of test result table.
-type DbResult struct {
-	Name      string     `db:"name"`
-	Result    TestResult `db:"result"`
-	Timestamp time.Time  `db:"timestamp"`
-}
+// Name of the MySQL advisory lock which serializes migrations of concurrent processes.
+const mysqlMigrationLock = "tsgctf-checker.migrate"
+
+// Timeout in seconds to wait for the migration lock.
+const mysqlMigrationLockTimeout = 60
 
-// Converter of `Challenge` into `DBResult`.
-func (chall *Challenge) intoDbResult(result TestResult) DbResult {
-	return DbResult{
-		Name:   chall.Name,
-		Result: result,
+// Build the configuration of MySQL driver.
+func mysql_config(params DbParams) (*mysql.Config, error) {
+	if params.DSN != "" {
+		cfg, err := mysql.ParseDSN(params.DSN)
+		if err != nil {
+			return nil, err
+		}
+		// timestamps are scanned into time.Time
+		cfg.ParseTime = true
+		return cfg, nil
+	}
+
+	// the server name to verify is taken from the host, which a socket does not have
+	if params.Socket != "" && params.TLS.enabled() {
+		return nil, fmt.Errorf("TLS cannot be used with the unix socket of MySQL. Connect by host and port, or give the DSN.")
 	}
-}
 
-// Connect to mysql server and returns instance.
-func Connect(dbuser string, dbpass string, dbhost string, dbname string) (*sqlx.DB, error) {
 	cfg := mysql.NewConfig()
-	cfg.Net = "tcp"
-	cfg.Addr = net.JoinHostPort(dbhost, "3306")
-	cfg.DBName = dbname
-	cfg.User = dbuser
-	cfg.Passwd = dbpass
+	if params.Socket != "" {
+		cfg.Net = "unix"
+		cfg.Addr = params.Socket
+	} else {
+		cfg.Net = "tcp"
+		cfg.Addr = net.JoinHostPort(params.Host, params.port_or(3306))
+	}
+	cfg.DBName = params.Name
+	cfg.User = params.User
+	cfg.Passwd = params.Pass
 	cfg.ParseTime = true
-	db, err := sqlx.Connect("mysql", cfg.FormatDSN())
+	if params.TLS.enabled() {
+		tls_config, err := params.TLS.load(params.Host)
+		if err != nil {
+			return nil, err
+		}
+		cfg.TLS = tls_config
+	}
+	return cfg, nil
+}
+
+// Connect to mysql server and returns instance.
+func Connect(params DbParams) (*sqlx.DB, error) {
+	cfg, err := mysql_config(params)
 	if err != nil {
 		return nil, err
 	}
+	// TLS configuration is lost by formatting DSN, so the connector is used directly
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	db := sqlx.NewDb(sql.OpenDB(connector), "mysql")
+	params.apply_pool(db)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
 	return db, nil
 }
 
-// Write and commit test result.
-func RecordResult(db *sqlx.DB, chall Challenge, result TestResult) error {
-	tx := db.MustBegin()
-	dbresult := chall.intoDbResult(result)
-	dbresult.Timestamp = time.Now()
-	query := "insert into test_result(name, result, timestamp) values(:name, :result, :timestamp)"
-	_, err := tx.NamedExec(query, dbresult)
-	if err != nil {
+// Add a column unless it already exists.
+func mysql_add_column(ctx context.Context, conn *sqlx.Conn, table string, column string, definition string) error {
+	var count int
+	query := `select count(*) from information_schema.columns where table_schema = database() and table_name = ? and column_name = ?`
+	if err := conn.GetContext(ctx, &count, query, table, column); err != nil {
 		return err
 	}
-	if err := tx.Commit(); err != nil {
-		return err
+	if count > 0 {
+		return nil
 	}
-
-	return nil
+	return exec_all(ctx, conn, fmt.Sprintf("alter table `%s` add column `%s` %s", table, column, definition))
 }
 
-// Query test result from DB by challenge ID.
-func FetchResult(db *sqlx.DB, chall_name string, limit int) ([]DbResult, error) {
-	var results []DbResult
-
-	query := `select name, result, timestamp from test_result where name = ? order by timestamp desc limit ?`
-	tx := db.MustBegin()
-	if err := tx.Select(&results, query, chall_name, limit); err != nil {
-		return results, err
+// Add an index unless it already exists.
+func mysql_add_index(ctx context.Context, conn *sqlx.Conn, table string, index string, columns string) error {
+	var count int
+	query := `select count(*) from information_schema.statistics where table_schema = database() and table_name = ? and index_name = ?`
+	if err := conn.GetContext(ctx, &count, query, table, index); err != nil {
+		return err
 	}
-	if err := tx.Commit(); err != nil {
-		return results, err
+	if count > 0 {
+		return nil
 	}
-	return results, nil
+	return exec_all(ctx, conn, fmt.Sprintf("create index `%s` on `%s` (%s)", index, table, columns))
+}
+
+// Tables created by older `init.sql` are upgraded by these migrations without losing records.
+var mysqlDialect = dialect{
+	version_table_query: `select count(*) from information_schema.tables where table_schema = database() and table_name = 'schema_version'`,
+	timestamp_type:      "datetime",
+	lock: func(ctx context.Context, conn *sqlx.Conn) (func(), error) {
+		var locked int
+		if err := conn.GetContext(ctx, &locked, "select get_lock(?, ?)", mysqlMigrationLock, mysqlMigrationLockTimeout); err != nil {
+			return nil, err
+		}
+		if locked != 1 {
+			return nil, fmt.Errorf("Failed to acquire migration lock in %d seconds.", mysqlMigrationLockTimeout)
+		}
+		return func() { conn.ExecContext(ctx, "select release_lock(?)", mysqlMigrationLock) }, nil
+	},
+	migrations: []migration{
+		{
+			version:     1,
+			description: "create test_result",
+			// `result` is a value of `TestResult` in executer.go
+			apply: func(ctx context.Context, conn *sqlx.Conn) error {
+				return exec_all(ctx, conn,
+					"create table if not exists `test_result` ("+
+						"`name` varchar(255) not null, "+
+						"`result` int not null, "+
+						"`timestamp` datetime not null"+
+						") default character set utf8mb4",
+				)
+			},
+		},
+		{
+			version:     2,
+			description: "add attempt and run_id to test_result, create test_log",
+			apply: func(ctx context.Context, conn *sqlx.Conn) error {
+				if err := mysql_add_column(ctx, conn, "test_result", "attempt", "int not null default 1"); err != nil {
+					return err
+				}
+				if err := mysql_add_column(ctx, conn, "test_result", "run_id", "varchar(32) not null default ''"); err != nil {
+					return err
+				}
+				return exec_all(ctx, conn,
+					"create table if not exists `test_log` ("+
+						"`run_id` varchar(32) not null, "+
+						"`name` varchar(255) not null, "+
+						"`attempt` int not null, "+
+						"`stdout` mediumtext not null, "+
+						"`stderr` mediumtext not null, "+
+						"`timestamp` datetime not null"+
+						") default character set utf8mb4",
+				)
+			},
+		},
+		{
+			version:     3,
+			description: "create build_result",
+			apply: func(ctx context.Context, conn *sqlx.Conn) error {
+				return exec_all(ctx, conn,
+					"create table if not exists `build_result` ("+
+						"`name` varchar(255) not null, "+
+						"`result` int not null, "+
+						"`solver_hash` varchar(64) not null, "+
+						"`cached` boolean not null, "+
+						"`timestamp` datetime not null"+
+						") default character set utf8mb4",
+				)
+			},
+		},
+		{
+			version:     4,
+			description: "add build_duration, run_duration and exit_code to test_result",
+			apply: func(ctx context.Context, conn *sqlx.Conn) error {
+				if err := mysql_add_column(ctx, conn, "test_result", "build_duration", "double not null default 0"); err != nil {
+					return err
+				}
+				if err := mysql_add_column(ctx, conn, "test_result", "run_duration", "double not null default 0"); err != nil {
+					return err
+				}
+				return mysql_add_column(ctx, conn, "test_result", "exit_code", "int not null default -1")
+			},
+		},
+		{
+			version:     5,
+			description: "add primary keys and indexes",
+			apply: func(ctx context.Context, conn *sqlx.Conn) error {
+				for _, table := range []string{"test_result", "test_log", "build_result"} {
+					if err := mysql_add_column(ctx, conn, table, "id", "bigint unsigned not null auto_increment primary key first"); err != nil {
+						return err
+					}
+				}
+				if err := mysql_add_index(ctx, conn, "test_result", "idx_test_result_name_timestamp", "name, timestamp"); err != nil {
+					return err
+				}
+				if err := mysql_add_index(ctx, conn, "test_log", "idx_test_log_name_run_id_attempt", "name, run_id, attempt"); err != nil {
+					return err
+				}
+				return mysql_add_index(ctx, conn, "build_result", "idx_build_result_name_timestamp", "name, timestamp")
+			},
+		},
+		{
+			version:     6,
+			description: "add genre to test_result",
+			apply: func(ctx context.Context, conn *sqlx.Conn) error {
+				return mysql_add_column(ctx, conn, "test_result", "genre", "varchar(255) not null default ''")
+			},
+		},
+		{
+			version:     7,
+			description: "create maintenance_window",
+			apply: func(ctx context.Context, conn *sqlx.Conn) error {
+				if err := exec_all(ctx, conn,
+					"create table if not exists `maintenance_window` ("+
+						"`id` bigint unsigned not null auto_increment primary key, "+
+						"`challenge` varchar(255) not null default '', "+
+						"`genre` varchar(255) not null default '', "+
+						"`start_at` datetime not null, "+
+						"`end_at` datetime not null, "+
+						"`reason` varchar(1024) not null default ''"+
+						") default character set utf8mb4",
+				); err != nil {
+					return err
+				}
+				return mysql_add_index(ctx, conn, "maintenance_window", "idx_maintenance_window_end_at", "end_at")
+			},
+		},
+		{
+			version:     8,
+			description: "create slack_thread",
+			apply: func(ctx context.Context, conn *sqlx.Conn) error {
+				return exec_all(ctx, conn,
+					"create table if not exists `slack_thread` ("+
+						"`channel` varchar(255) not null, "+
+						"`challenge` varchar(255) not null, "+
+						"`channel_id` varchar(255) not null, "+
+						"`ts` varchar(64) not null, "+
+						"primary key (`channel`, `challenge`)"+
+						") default character set utf8mb4",
+				)
+			},
+		},
+	},
 }
@@ -9,9 +9,9 @@ import (
 
 	"github.com/docker/go-connections/nat"
 	"github.com/go-sql-driver/mysql"
-	"github.com/jmoiron/sqlx"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
+	"go.uber.org/zap"
 )
 
 const (
@@ -64,7 +64,7 @@ func setupMysql(ctx context.Context) (*mysqlContainer, error) {
 }
 
 // Open MySQL connection.
-func (s *mysqlContainer) OpenDB(ctx context.Context) (*sqlx.DB, error) {
+func (s *mysqlContainer) OpenStore(ctx context.Context) (*SQLStore, error) {
 	host, err := s.Container.Host(ctx)
 	if err != nil {
 		return nil, err
@@ -75,23 +75,22 @@ func (s *mysqlContainer) OpenDB(ctx context.Context) (*sqlx.DB, error) {
 		return nil, err
 	}
 
-	cfg := mysql.NewConfig()
-	cfg.Net = "tcp"
-	cfg.Addr = net.JoinHostPort(host, port.Port())
-	cfg.DBName = "test"
-	cfg.User = "user"
-	cfg.Passwd = "password"
-	cfg.ParseTime = true
-
-	return sqlx.ConnectContext(ctx, "mysql", cfg.FormatDSN())
-}
-
-func count_records(db *sqlx.DB) (int, error) {
-	var count int
-	if err := db.Get(&count, "select count(*) from test_result"); err != nil {
-		return 0, err
+	store, err := OpenStore(DbParams{
+		Driver: "mysql",
+		User:   "user",
+		Pass:   "password",
+		Host:   host,
+		Port:   port.Int(),
+		Name:   "test",
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the container is initialized with the schema of the oldest `init.sql`
+	if err := store.Migrate(zap.NewNop().Sugar()); err != nil {
+		return nil, err
 	}
-	return count, nil
+	return store, nil
 }
 
 func TestMysql_MysqlOperations(t *testing.T) {
@@ -102,39 +101,9 @@ func TestMysql_MysqlOperations(t *testing.T) {
 	}
 	defer container.Terminate(ctx)
 
-	db, _ := container.OpenDB(ctx)
-
-	// record results
-	chall := Challenge{
-		Name:    "test",
-		Timeout: 5,
-	}
-	for i := 0; i < 3; i++ {
-		if err := RecordResult(db, chall, ResultSuccess); err != nil {
-			t.Fatal(err)
-		}
-	}
-
-	count, err := count_records(db)
-	if err != nil {
-		t.Fatal(err)
-	}
-	if count != 3 {
-		t.Errorf("count = %d, want 3", count)
-	}
-
-	// fetch results
-	results, err := FetchResult(db, chall.Name, 2)
+	store, err := container.OpenStore(ctx)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if len(results) != 2 {
-		t.Fatalf("len(results) = %d, want 2", len(results))
-	}
-	if results[0].Result != ResultSuccess {
-		t.Errorf("results[0].Result = %v, want %v", results[0].Result, ResultSuccess)
-	}
-	if results[0].Name != chall.Name {
-		t.Errorf("results[0].Name = %v, want %v", results[0].Name, chall.Name)
-	}
+	test_store_operations(t, store)
 }
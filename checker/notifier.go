@@ -0,0 +1,124 @@
+package checker
+
+// This file defines notifiers of failed tests and their configuration.
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/slack-go/slack"
+	"go.uber.org/zap"
+)
+
+// Timeout of HTTP requests sent by notifiers.
+const notifyTimeout = 10 * time.Second
+
+// A failed test or a recovery notified to organizers.
+type Notification struct {
+	Kind      string // NotifyAlert or NotifyRecovery
+	Chall     Challenge
+	Result    TestResult
+	Stdout    string
+	Errlog    string
+	RunID     string
+	Attempt   uint
+	Timestamp time.Time
+	// number of consecutive failed test cycles
+	Failures uint
+	// timestamp of the first failure of the consecutive ones
+	BrokenSince time.Time
+	// challenges which could not be tested due to checker errors.
+	// Only set for notifications of the health of the checker, whose Chall is empty.
+	Affected []string
+}
+
+// Destination of notifications, such as Slack, Discord or a webhook.
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// Configuration of a notifier in CheckerConfig.
+type NotifierConfig struct {
+	Type string `json:"type"` // "slack", "discord" or "webhook"
+	// Slack
+	Token   string `json:"token"`
+	Channel string `json:"channel"`
+	APIURL  string `json:"api_url"` // base URL of Slack API, for testing
+	// attach the "Re-run" button to alerts. Requires the endpoint of `checker serve`.
+	RerunButton bool `json:"rerun_button"`
+	// Discord and webhook
+	URL string `json:"url"`
+	// webhook
+	Method      string            `json:"method"`       // default to POST
+	Headers     map[string]string `json:"headers"`      // extra HTTP headers
+	ContentType string            `json:"content_type"` // default to application/json
+	Template    string            `json:"template"`     // text/template of the body. Notification is passed as `.`
+}
+
+// Create a notifier from its configuration.
+func NewNotifier(conf NotifierConfig, logger *zap.SugaredLogger) (Notifier, error) {
+	switch conf.Type {
+	case "slack":
+		if conf.Token == "" || conf.Channel == "" {
+			return nil, fmt.Errorf("Slack notifier requires token and channel")
+		}
+		options := make([]slack.Option, 0)
+		if conf.APIURL != "" {
+			options = append(options, slack.OptionAPIURL(conf.APIURL))
+		}
+		notifier := NewSlackNotifier(conf.Token, conf.Channel, logger, options...)
+		notifier.rerun_button = conf.RerunButton
+		return notifier, nil
+	case "discord":
+		if conf.URL == "" {
+			return nil, fmt.Errorf("Discord notifier requires url")
+		}
+		return NewDiscordNotifier(conf.URL), nil
+	case "webhook":
+		return NewWebhookNotifier(conf)
+	default:
+		return nil, fmt.Errorf("Unknown notifier type: %s", conf.Type)
+	}
+}
+
+// Create notifiers enabled by the configuration.
+// The Slack notifier of `slack_token` and `slack_channel` is included if `NotifySlack` is set,
+// with the "Re-run" button if `slack_signing_secret` is set.
+// Slack notifiers keep the threads of open alerts in `store`, or in memory if it is nil.
+func NewNotifiers(conf CheckerConfig, logger *zap.SugaredLogger, store ResultStore) ([]Notifier, error) {
+	notifiers := make([]Notifier, 0)
+	if conf.NotifySlack && conf.SlackToken != "" && conf.SlackChannel != "" {
+		notifier := NewSlackNotifier(conf.SlackToken, conf.SlackChannel, logger)
+		notifier.rerun_button = conf.SlackSecret != ""
+		notifiers = append(notifiers, notifier)
+	}
+	for i, notifier_conf := range conf.Notifiers {
+		notifier, err := NewNotifier(notifier_conf, logger)
+		if err != nil {
+			return nil, fmt.Errorf("notifiers[%d]: %v", i, err)
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	if store != nil {
+		for _, notifier := range notifiers {
+			if slack_notifier, ok := notifier.(*SlackNotifier); ok {
+				slack_notifier.threads = store
+			}
+		}
+	}
+	return notifiers, nil
+}
+
+// Send a notification to all notifiers. Failures are logged and do not stop the others.
+func notify_all(logger *zap.SugaredLogger, notifiers []Notifier, n Notification) {
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(n); err != nil {
+			logger.Errorw("Failed to send notification", "challenge", n.Chall.Name, "notifier", fmt.Sprintf("%T", notifier), "error", err)
+		}
+	}
+}
+
+func new_http_client() *http.Client {
+	return &http.Client{Timeout: notifyTimeout}
+}
@@ -0,0 +1,214 @@
+package checker
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// Local HTTP stand-in which records the requests.
+type requestRecorder struct {
+	server   *httptest.Server
+	requests []*http.Request
+	bodies   []string
+	status   int
+	response string
+}
+
+func new_request_recorder(t *testing.T, status int, response string) *requestRecorder {
+	r := &requestRecorder{status: status, response: response}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.requests = append(r.requests, req)
+		r.bodies = append(r.bodies, string(body))
+		w.WriteHeader(r.status)
+		io.WriteString(w, r.response)
+	}))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func test_notification() Notification {
+	return Notification{
+		Chall:     Challenge{Name: "test-chall", Genre: "pwn", Assignee: "U012345"},
+		Result:    ResultFailure,
+		Stdout:    "stdout",
+		Errlog:    "stderr \"quoted\"",
+		RunID:     "0123456789abcdef",
+		Attempt:   2,
+		Timestamp: time.Date(2023, 10, 15, 13, 28, 33, 0, time.UTC),
+	}
+}
+
+func TestNotifier_Slack(t *testing.T) {
+	recorder := new_request_recorder(t, http.StatusOK, `{"ok": true, "channel": "C012345", "ts": "1.0"}`)
+	notifier, err := NewNotifier(NotifierConfig{Type: "slack", Token: "xoxb-test", Channel: "#status", APIURL: recorder.server.URL + "/"}, create_logger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := notifier.Notify(test_notification()); err != nil {
+		t.Fatal(err)
+	}
+
+	// summary and details in its thread
+	if len(recorder.requests) != 2 || recorder.requests[0].URL.Path != "/chat.postMessage" {
+		t.Fatalf("Expected requests to chat.postMessage, got %d requests", len(recorder.requests))
+	}
+	form, err := url.ParseQuery(recorder.bodies[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if form.Get("channel") != "#status" || !strings.Contains(form.Get("text"), "<@U012345>") {
+		t.Errorf("Unexpected message: %v", form)
+	}
+}
+
+func TestNotifier_Discord(t *testing.T) {
+	recorder := new_request_recorder(t, http.StatusNoContent, "")
+	notifier, err := NewNotifier(NotifierConfig{Type: "discord", URL: recorder.server.URL}, create_logger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := test_notification()
+	n.Stdout = strings.Repeat("x", 10000)
+	if err := notifier.Notify(n); err != nil {
+		t.Fatal(err)
+	}
+
+	var body struct {
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal([]byte(recorder.bodies[0]), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Content) > discordMessageLimit || !strings.Contains(body.Content, "test-chall") {
+		t.Errorf("Unexpected content of %d bytes: %.100s", len(body.Content), body.Content)
+	}
+}
+
+func TestNotifier_DiscordMessage(t *testing.T) {
+	// multi-byte characters at every offset of the cut points
+	for offset := 0; offset < 3; offset++ {
+		n := test_notification()
+		n.Stdout = strings.Repeat("a", offset) + strings.Repeat("あ", 1000)
+		n.Errlog = strings.Repeat("い", 1000) + strings.Repeat("b", offset)
+		msg := discord_message(n)
+
+		if len(msg) > discordMessageLimit || !utf8.ValidString(msg) {
+			t.Errorf("[%d] Message must be valid UTF-8 of at most %d bytes, got %d bytes", offset, discordMessageLimit, len(msg))
+		}
+		// outputs are truncated inside the code blocks
+		head := "STDOUT:\n```\n" + strings.Repeat("a", offset) + "あ"
+		tail := "い" + strings.Repeat("b", offset) + "\n```\n"
+		if !strings.Contains(msg, head) || !strings.Contains(msg, "あ\n```\nSTDERR:\n```\nい") || !strings.HasSuffix(msg, tail) {
+			t.Errorf("[%d] Code blocks must be kept: %s", offset, msg)
+		}
+		if strings.Count(msg, "bytes truncated") != 2 {
+			t.Errorf("[%d] Both outputs must be truncated: %s", offset, msg)
+		}
+	}
+
+	// a short output leaves the rest of the limit to the other
+	n := test_notification()
+	n.Errlog = strings.Repeat("x", 10000)
+	if msg := discord_message(n); !strings.Contains(msg, "STDOUT:\n```\nstdout\n```\n") || len(msg) < discordMessageLimit-64 {
+		t.Errorf("Unexpected message of %d bytes: %.200s", len(msg), msg)
+	}
+}
+
+func TestNotifier_Webhook(t *testing.T) {
+	recorder := new_request_recorder(t, http.StatusOK, "")
+
+	// default body
+	notifier, err := NewNotifier(NotifierConfig{Type: "webhook", URL: recorder.server.URL, Headers: map[string]string{"Authorization": "Bearer secret"}}, create_logger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := notifier.Notify(test_notification()); err != nil {
+		t.Fatal(err)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal([]byte(recorder.bodies[0]), &payload); err != nil {
+		t.Fatalf("Invalid JSON: %v\n%s", err, recorder.bodies[0])
+	}
+	if payload["challenge"] != "test-chall" || payload["result"] != "failure" || payload["stderr"] != "stderr \"quoted\"" || payload["attempt"] != 2.0 {
+		t.Errorf("Unexpected payload: %v", payload)
+	}
+	if recorder.requests[0].Header.Get("Authorization") != "Bearer secret" || recorder.requests[0].Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Unexpected headers: %v", recorder.requests[0].Header)
+	}
+
+	// custom body
+	notifier, err = NewNotifier(NotifierConfig{Type: "webhook", URL: recorder.server.URL, Method: http.MethodPut, ContentType: "text/plain", Template: "{{.Chall.Name}} is {{.Result.ToMessage}}"}, create_logger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := notifier.Notify(test_notification()); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.requests[1].Method != http.MethodPut || recorder.bodies[1] != "test-chall is Unsolvable" {
+		t.Errorf("Unexpected request: %s %s", recorder.requests[1].Method, recorder.bodies[1])
+	}
+
+	// truncated without splitting a character
+	notifier, err = NewNotifier(NotifierConfig{Type: "webhook", URL: recorder.server.URL, Template: `{"stdout": {{json (truncate 5 .Stdout)}}}`}, create_logger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := test_notification()
+	n.Stdout = "あいう"
+	if err := notifier.Notify(n); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.bodies[2] != `{"stdout": "あ"}` {
+		t.Errorf("Unexpected body: %s", recorder.bodies[2])
+	}
+
+	// error response
+	recorder.status = http.StatusInternalServerError
+	if err := notifier.Notify(test_notification()); err == nil {
+		t.Errorf("Expected error for status 500")
+	}
+}
+
+func TestNotifier_NewNotifiers(t *testing.T) {
+	conf := CheckerConfig{
+		SlackToken:   "xoxb-test",
+		SlackChannel: "#status",
+		NotifySlack:  true,
+		Notifiers: []NotifierConfig{
+			{Type: "discord", URL: "http://localhost/discord"},
+			{Type: "webhook", URL: "http://localhost/webhook"},
+		},
+	}
+	notifiers, err := NewNotifiers(conf, create_logger(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifiers) != 3 {
+		t.Errorf("Expected 3 notifiers, got %d", len(notifiers))
+	}
+
+	for _, invalid := range []NotifierConfig{{Type: "email"}, {Type: "discord"}, {Type: "webhook", URL: "http://localhost", Template: "{{"}} {
+		if _, err := NewNotifiers(CheckerConfig{Notifiers: []NotifierConfig{invalid}}, create_logger(), nil); err == nil {
+			t.Errorf("Expected error for %+v", invalid)
+		}
+	}
+}
+
+func TestNotifier_CheckerHealth(t *testing.T) {
+	n := Notification{Kind: NotifyAlert, Result: ResultInfraError, Affected: []string{"pwn", "web"}, Failures: 1}
+	if summary := alert_summary(n); !strings.Contains(summary, "2 challenges") || !strings.Contains(summary, "`pwn`, `web`") {
+		t.Errorf("Unexpected summary: %s", summary)
+	}
+	n = Notification{Kind: NotifyRecovery, Result: ResultSuccess, Failures: 3, Timestamp: time.Unix(600, 0), BrokenSince: time.Unix(0, 0)}
+	if msg := recovery_message(n); !strings.HasPrefix(msg, "Checker infrastructure recovered") || !strings.Contains(msg, "10m0s (3 test cycles)") {
+		t.Errorf("Unexpected recovery: %s", msg)
+	}
+}
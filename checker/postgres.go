@@ -0,0 +1,151 @@
+package checker
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// Key of the PostgreSQL advisory lock which serializes migrations of concurrent processes.
+const postgresMigrationLock = 0x7473676374660001
+
+// Quote a value of a key/value connection string of lib/pq.
+func pq_quote(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// Build the connection string of PostgreSQL driver.
+func postgres_dsn(params DbParams) string {
+	if params.DSN != "" {
+		return params.DSN
+	}
+
+	host := params.Host
+	if params.Socket != "" {
+		// lib/pq treats a host starting with "/" as the directory of the unix socket
+		host = params.Socket
+	}
+	options := []string{
+		"host=" + pq_quote(host),
+		"port=" + params.port_or(5432),
+		"user=" + pq_quote(params.User),
+		"password=" + pq_quote(params.Pass),
+		"dbname=" + pq_quote(params.Name),
+	}
+	if params.TLS.enabled() {
+		options = append(options, "sslmode=verify-full")
+		if params.TLS.CA != "" {
+			options = append(options, "sslrootcert="+pq_quote(params.TLS.CA))
+		}
+		if params.TLS.Cert != "" {
+			options = append(options, "sslcert="+pq_quote(params.TLS.Cert), "sslkey="+pq_quote(params.TLS.Key))
+		}
+	} else {
+		options = append(options, "sslmode=disable")
+	}
+	return strings.Join(options, " ")
+}
+
+// Connect to PostgreSQL server and returns instance.
+func ConnectPostgres(params DbParams) (*sqlx.DB, error) {
+	db, err := sqlx.Connect("postgres", postgres_dsn(params))
+	if err != nil {
+		return nil, err
+	}
+	params.apply_pool(db)
+	return db, nil
+}
+
+var postgresDialect = dialect{
+	version_table_query: `select count(*) from information_schema.tables where table_schema = current_schema() and table_name = 'schema_version'`,
+	timestamp_type:      "timestamptz",
+	lock: func(ctx context.Context, conn *sqlx.Conn) (func(), error) {
+		if _, err := conn.ExecContext(ctx, "select pg_advisory_lock($1)", postgresMigrationLock); err != nil {
+			return nil, err
+		}
+		return func() { conn.ExecContext(ctx, "select pg_advisory_unlock($1)", postgresMigrationLock) }, nil
+	},
+	migrations: []migration{
+		{
+			version:     1,
+			description: "create tables",
+			// `result` is a value of `TestResult` in executer.go
+			apply: func(ctx context.Context, conn *sqlx.Conn) error {
+				return exec_all(ctx, conn,
+					"create table if not exists test_result ("+
+						"id bigserial primary key, "+
+						"name varchar(255) not null, "+
+						"result int not null, "+
+						"timestamp timestamptz not null, "+
+						"attempt int not null default 1, "+
+						"run_id varchar(32) not null default '', "+
+						"build_duration double precision not null default 0, "+
+						"run_duration double precision not null default 0, "+
+						"exit_code int not null default -1"+
+						")",
+					"create index if not exists idx_test_result_name_timestamp on test_result (name, timestamp)",
+					"create table if not exists test_log ("+
+						"id bigserial primary key, "+
+						"run_id varchar(32) not null, "+
+						"name varchar(255) not null, "+
+						"attempt int not null, "+
+						"stdout text not null, "+
+						"stderr text not null, "+
+						"timestamp timestamptz not null"+
+						")",
+					"create index if not exists idx_test_log_name_run_id_attempt on test_log (name, run_id, attempt)",
+					"create table if not exists build_result ("+
+						"id bigserial primary key, "+
+						"name varchar(255) not null, "+
+						"result int not null, "+
+						"solver_hash varchar(64) not null, "+
+						"cached boolean not null, "+
+						"timestamp timestamptz not null"+
+						")",
+					"create index if not exists idx_build_result_name_timestamp on build_result (name, timestamp)",
+				)
+			},
+		},
+		{
+			version:     2,
+			description: "add genre to test_result",
+			apply: func(ctx context.Context, conn *sqlx.Conn) error {
+				return exec_all(ctx, conn, "alter table test_result add column if not exists genre varchar(255) not null default ''")
+			},
+		},
+		{
+			version:     3,
+			description: "create maintenance_window",
+			apply: func(ctx context.Context, conn *sqlx.Conn) error {
+				return exec_all(ctx, conn,
+					"create table if not exists maintenance_window ("+
+						"id bigserial primary key, "+
+						"challenge varchar(255) not null default '', "+
+						"genre varchar(255) not null default '', "+
+						"start_at timestamptz not null, "+
+						"end_at timestamptz not null, "+
+						"reason varchar(1024) not null default ''"+
+						")",
+					"create index if not exists idx_maintenance_window_end_at on maintenance_window (end_at)",
+				)
+			},
+		},
+		{
+			version:     4,
+			description: "create slack_thread",
+			apply: func(ctx context.Context, conn *sqlx.Conn) error {
+				return exec_all(ctx, conn,
+					"create table if not exists slack_thread ("+
+						"channel varchar(255) not null, "+
+						"challenge varchar(255) not null, "+
+						"channel_id varchar(255) not null, "+
+						"ts varchar(64) not null, "+
+						"primary key (channel, challenge)"+
+						")",
+				)
+			},
+		},
+	},
+}
@@ -0,0 +1,72 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+const (
+	TEST_POSTGRES_PORT = "5432"
+)
+
+func test_postgres_params(host string, port nat.Port) DbParams {
+	return DbParams{
+		Driver: "postgres",
+		User:   "user",
+		Pass:   "password",
+		Host:   host,
+		Port:   port.Int(),
+		Name:   "test",
+	}
+}
+
+func TestPostgres_PostgresOperations(t *testing.T) {
+	ctx := context.Background()
+	req := testcontainers.ContainerRequest{
+		Image: "postgres:16",
+		Env: map[string]string{
+			"POSTGRES_DB":       "test",
+			"POSTGRES_USER":     "user",
+			"POSTGRES_PASSWORD": "password",
+		},
+		ExposedPorts: []string{fmt.Sprintf("%s/tcp", TEST_POSTGRES_PORT)},
+		WaitingFor: wait.ForSQL(TEST_POSTGRES_PORT, "postgres", func(host string, port nat.Port) string {
+			return postgres_dsn(test_postgres_params(host, port))
+		}),
+	}
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer container.Terminate(ctx)
+
+	host, err := container.Host(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := container.MappedPort(ctx, TEST_POSTGRES_PORT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := OpenStore(test_postgres_params(host, port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := store.Migrate(create_logger()); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.VerifySchema(); err != nil {
+		t.Fatal(err)
+	}
+	test_store_operations(t, store)
+}
@@ -0,0 +1,213 @@
+package checker
+
+// This file implements the prebuild phase which builds solver images before running tests.
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"go.uber.org/zap"
+)
+
+// Outcome of a prebuild of a solver image.
+type buildOutcome struct {
+	chall       Challenge
+	image       string
+	solver_hash string
+	cached      bool // the image was already built with the same solver
+	result      TestResult
+	log         string
+	build_time  time.Duration
+}
+
+// Calculate a hash of the contents of the solver directory.
+// The hash changes when any file is added, removed, renamed, or modified.
+func hash_solver_dir(solver_dir string) (string, error) {
+	hash := sha256.New()
+	err := filepath.WalkDir(solver_dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(solver_dir, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hash, "%s\x00%o\x00", filepath.ToSlash(rel), info.Mode())
+
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hash, "%s\x00", target)
+		case info.Mode().IsRegular():
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if _, err := io.Copy(hash, f); err != nil {
+				return err
+			}
+			hash.Write([]byte{0})
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Name of the cached solver image built from the solver with the given hash.
+func cached_image_name(chall Challenge, solver_hash string) string {
+	return fmt.Sprintf("solver_%s:%s", strings.ToLower(chall.Name), solver_hash[:12])
+}
+
+// Check if an image exists.
+func image_exists(ctx context.Context, docker DockerClient, image_name string) (bool, error) {
+	_, _, err := docker.ImageInspectWithRaw(ctx, image_name)
+	if err == nil {
+		return true, nil
+	}
+	if client.IsErrNotFound(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// Remove images of the challenge built from old solvers.
+func remove_stale_images(logger *zap.SugaredLogger, docker DockerClient, chall Challenge, solver_hash string) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+
+	images, err := docker.ImageList(ctx, types.ImageListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", labelChallenge, chall.Name))),
+	})
+	if err != nil {
+		logger.Warnf("[%s] Failed to list stale images: %v", chall.Name, err)
+		return
+	}
+	for _, image := range images {
+		hash, ok := image.Labels[labelSolverHash]
+		if !ok || hash == solver_hash {
+			continue
+		}
+		if _, err := docker.ImageRemove(ctx, image.ID, types.ImageRemoveOptions{}); err != nil {
+			logger.Debugf("[%s] Failed to remove stale image %s: %v", chall.Name, image.ID, err)
+			continue
+		}
+		logger.Infof("[%s] Removed stale image %s.", chall.Name, image.ID)
+	}
+}
+
+// Build a solver image of a challenge unless it is already built from the same solver.
+func prebuild_image(ctx context.Context, logger *zap.SugaredLogger, docker DockerClient, chall Challenge) buildOutcome {
+	outcome := buildOutcome{chall: chall, result: ResultSuccess}
+
+	solver_hash, err := hash_solver_dir(chall.SolverDir)
+	if err != nil {
+		outcome.result = ResultExecutionFailure
+		outcome.log = fmt.Sprintf("Failed to read solver directory: %v", err)
+		return outcome
+	}
+	outcome.solver_hash = solver_hash
+	outcome.image = cached_image_name(chall, solver_hash)
+
+	exists, err := image_exists(ctx, docker, outcome.image)
+	if err != nil {
+		outcome.result = ResultInfraError
+		outcome.log = err.Error()
+		return outcome
+	}
+	if exists {
+		logger.Infof("[%s] Use cached image %s.", chall.Name, outcome.image)
+		outcome.cached = true
+		return outcome
+	}
+
+	logger.Infof("[%s] Building image %s.", chall.Name, outcome.image)
+	build_ctx, cancel := context.WithTimeout(ctx, chall.phase_timeout(PhaseBuild))
+	defer cancel()
+	labels := map[string]string{
+		labelManaged:    "true",
+		labelChallenge:  chall.Name,
+		labelSolverHash: solver_hash,
+	}
+	build_started := time.Now()
+	build_log, err := build_image(build_ctx, docker, chall.SolverDir, outcome.image, labels)
+	outcome.build_time = time.Since(build_started)
+	outcome.log = build_log
+	switch {
+	case err == nil:
+		logger.Infof("[%s] Image %s built in %v.", chall.Name, outcome.image, outcome.build_time.Round(time.Millisecond))
+		remove_stale_images(logger, docker, chall, solver_hash)
+	case ctx.Err() != nil:
+		outcome.result = ResultTestInterrupted
+	case errors.Is(build_ctx.Err(), context.DeadlineExceeded):
+		logger.Infof("[%s] Timed out in build phase.", chall.Name)
+		outcome.result = ResultTimeout
+		outcome.log = fmt.Sprintf("%s\nTimed out in build phase.", build_log)
+	default:
+		logger.Warnf("[%s] Failed to build image: %v", chall.Name, err)
+		outcome.result = classify_docker_error(err)
+		outcome.log = fmt.Sprintf("%s\n%v", build_log, err)
+	}
+
+	return outcome
+}
+
+// Build solver images of all challenges before running tests.
+// At most conf.BuildParallelNum images are built concurrently.
+// Builds are cancelled when ctx is cancelled.
+func prebuild_images(ctx context.Context, logger *zap.SugaredLogger, conf CheckerConfig, docker DockerClient, challs []Challenge) map[string]buildOutcome {
+	parallel := conf.BuildParallelNum
+	if parallel == 0 {
+		parallel = 1
+	}
+	semaphore := make(chan struct{}, parallel)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	outcomes := make(map[string]buildOutcome, len(challs))
+	started := time.Now()
+	for _, chall := range challs {
+		wg.Add(1)
+		go func(chall Challenge) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			outcome := buildOutcome{chall: chall, result: ResultTestInterrupted}
+			if ctx.Err() == nil {
+				outcome = prebuild_image(ctx, logger, docker, chall)
+			}
+			mu.Lock()
+			outcomes[chall.Name] = outcome
+			mu.Unlock()
+		}(chall)
+	}
+	wg.Wait()
+	logger.Infof("Prebuild of %d images finished in %v.", len(challs), time.Since(started).Round(time.Millisecond))
+
+	return outcomes
+}
@@ -0,0 +1,112 @@
+package checker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPrebuild_HashSolverDir(t *testing.T) {
+	solver_dir := t.TempDir()
+	write := func(name string, content string) {
+		if err := os.WriteFile(filepath.Join(solver_dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hash := func() string {
+		h, err := hash_solver_dir(solver_dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	write("Dockerfile", "FROM scratch\n")
+	write("exploit", "exit 0\n")
+	h1 := hash()
+	if h2 := hash(); h1 != h2 {
+		t.Errorf("hash is not stable: %s != %s", h1, h2)
+	}
+
+	write("exploit", "exit 1\n")
+	h3 := hash()
+	if h3 == h1 {
+		t.Errorf("hash not changed after modification")
+	}
+
+	os.Rename(filepath.Join(solver_dir, "exploit"), filepath.Join(solver_dir, "exploit.sh"))
+	if h4 := hash(); h4 == h3 {
+		t.Errorf("hash not changed after rename")
+	}
+}
+
+func TestPrebuild_PrebuildImages(t *testing.T) {
+	logger := create_logger()
+	solver_dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(solver_dir, "Dockerfile"), []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	challs := []Challenge{
+		{Name: "chall1", SolverDir: solver_dir, BuildTimeout: 60},
+		{Name: "chall2", SolverDir: solver_dir, BuildTimeout: 60},
+	}
+	docker := &fakeDocker{}
+	conf := CheckerConfig{BuildParallelNum: 2}
+
+	// first build
+	outcomes := prebuild_images(context.Background(), logger, conf, docker, challs)
+	for _, chall := range challs {
+		outcome := outcomes[chall.Name]
+		if outcome.result != ResultSuccess || outcome.cached {
+			t.Errorf("[%s] Expected fresh build, got result %d, cached %v", chall.Name, outcome.result, outcome.cached)
+		}
+	}
+	if outcomes["chall1"].image == outcomes["chall2"].image {
+		t.Errorf("Images of different challenges collide: %s", outcomes["chall1"].image)
+	}
+
+	// second build uses cache
+	outcomes = prebuild_images(context.Background(), logger, conf, docker, challs)
+	for _, chall := range challs {
+		if !outcomes[chall.Name].cached {
+			t.Errorf("[%s] Expected cached image", chall.Name)
+		}
+	}
+	if docker.num_builds != 2 {
+		t.Errorf("Expected 2 builds, got %d", docker.num_builds)
+	}
+
+	// solver changed
+	if err := os.WriteFile(filepath.Join(solver_dir, "exploit"), []byte("exit 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outcomes = prebuild_images(context.Background(), logger, conf, docker, challs[:1])
+	if outcomes["chall1"].cached || docker.num_builds != 3 {
+		t.Errorf("Expected rebuild after solver change, got cached %v, %d builds", outcomes["chall1"].cached, docker.num_builds)
+	}
+
+	// build failure
+	failing := &fakeDocker{build_error: "The command '/bin/sh -c false' returned a non-zero code: 1"}
+	outcomes = prebuild_images(context.Background(), logger, conf, failing, challs[:1])
+	if outcomes["chall1"].result != ResultBuildFailure {
+		t.Errorf("Expected build failure, got %d", outcomes["chall1"].result)
+	}
+
+	// build timeout
+	challs[0].BuildTimeout = 0.05
+	outcomes = prebuild_images(context.Background(), logger, conf, &fakeDocker{block_build: true}, challs[:1])
+	if outcomes["chall1"].result != ResultTimeout {
+		t.Errorf("Expected build timeout, got %d", outcomes["chall1"].result)
+	}
+
+	// cancelled by the caller
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	challs[0].BuildTimeout = 60
+	outcomes = prebuild_images(ctx, logger, conf, &fakeDocker{block_build: true}, challs[:1])
+	if outcomes["chall1"].result != ResultTestInterrupted {
+		t.Errorf("Expected interrupted build, got %d", outcomes["chall1"].result)
+	}
+}
@@ -0,0 +1,274 @@
+package checker
+
+// This file implements the report of a test cycle, which is written as JSON or JUnit XML.
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Maximum size in bytes of each of stdout and stderr kept in a report.
+const reportExcerptSize = 4 * 1024
+
+// Summary of a test cycle returned by RunRecordTests.
+type Report struct {
+	RunID      string    `json:"run_id"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// the cycle was cancelled before all tests finished
+	Interrupted bool              `json:"interrupted"`
+	Challenges  []ChallengeReport `json:"challenges"`
+}
+
+// Final result of a challenge in a test cycle.
+type ChallengeReport struct {
+	Name    string     `json:"name"`
+	Genre   string     `json:"genre"`
+	Result  TestResult `json:"result"`
+	Status  string     `json:"status"`  // machine-readable name of Result
+	Message string     `json:"message"` // message shown on the badge
+	Phase   string     `json:"phase"`
+	// number of attempts. 0 if the test did not run.
+	Attempts uint `json:"attempts"`
+	// seconds taken by all attempts
+	Duration float64 `json:"duration"`
+	// seconds taken to build and run the solver in the last attempt
+	BuildDuration float64   `json:"build_duration"`
+	RunDuration   float64   `json:"run_duration"`
+	ExitCode      int       `json:"exit_code"`
+	Stdout        string    `json:"stdout"` // excerpt of stdout of the last attempt
+	Stderr        string    `json:"stderr"` // excerpt of stderr of the last attempt
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+// Machine-readable name of a test result.
+func (tr TestResult) ToStatus() string {
+	switch tr {
+	case ResultSuccess:
+		return "success"
+	case ResultTimeout:
+		return "timeout"
+	case ResultExecutionFailure:
+		return "execution_failure"
+	case ResultTestInterrupted:
+		return "interrupted"
+	case ResultFailure:
+		return "failure"
+	case ResultRunning:
+		return "running"
+	case ResultBuildFailure:
+		return "build_failure"
+	case ResultInfraError:
+		return "infra_error"
+	case ResultMaintenance:
+		return "maintenance"
+	default:
+		return "unknown"
+	}
+}
+
+// The result shows that the challenge cannot be solved, as opposed to troubles of the checker.
+func (tr TestResult) unsolvable() bool {
+	switch tr {
+	case ResultFailure, ResultTimeout, ResultExecutionFailure, ResultBuildFailure:
+		return true
+	default:
+		return false
+	}
+}
+
+func new_report(run_id string, challs []Challenge) *Report {
+	report := &Report{
+		RunID:      run_id,
+		StartedAt:  time.Now(),
+		Challenges: make([]ChallengeReport, len(challs)),
+	}
+	for i, chall := range challs {
+		report.Challenges[i] = ChallengeReport{
+			Name:     chall.Name,
+			Genre:    chall.Genre,
+			Result:   ResultTestInterrupted,
+			Status:   ResultTestInterrupted.ToStatus(),
+			Message:  "Not tested",
+			ExitCode: -1,
+		}
+	}
+	return report
+}
+
+// Record a result of an attempt of a challenge.
+// The last recorded attempt is kept as the result of the challenge.
+func (r *Report) record(chall Challenge, res TestResultMessage, attempt uint) {
+	for i := range r.Challenges {
+		c := &r.Challenges[i]
+		if c.Name != chall.Name {
+			continue
+		}
+		c.Result = res.Result
+		c.Status = res.Result.ToStatus()
+		c.Message = res.Result.ToMessage()
+		c.Phase = res.Phase.String()
+		c.Attempts = attempt
+		c.Duration += (res.BuildTime + res.RunTime).Seconds()
+		c.BuildDuration = res.BuildTime.Seconds()
+		c.RunDuration = res.RunTime.Seconds()
+		c.ExitCode = res.ExitCode
+		c.Stdout = truncate_output(res.Stdout, reportExcerptSize)
+		c.Stderr = truncate_output(res.Errlog, reportExcerptSize)
+		c.Timestamp = res.Timestamp
+		return
+	}
+}
+
+// Number of challenges with the given result.
+func (r *Report) Count(result TestResult) int {
+	count := 0
+	for _, c := range r.Challenges {
+		if c.Result == result {
+			count++
+		}
+	}
+	return count
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// JUnit XML schema understood by common CI services.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     float64          `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      float64         `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+	SystemErr string        `xml:"system-err,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// Write the report as JUnit XML, where each challenge is a test case.
+// Unsolvable challenges are failures, troubles of the checker are errors,
+// and challenges not tested to the end or under maintenance are skipped.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	suite := junitTestSuite{
+		Name:      r.RunID,
+		Tests:     len(r.Challenges),
+		Time:      r.FinishedAt.Sub(r.StartedAt).Seconds(),
+		Timestamp: r.StartedAt.Format("2006-01-02T15:04:05"),
+		Cases:     make([]junitTestCase, 0, len(r.Challenges)),
+	}
+	for _, c := range r.Challenges {
+		class_name := "tsgctf-checker"
+		if c.Genre != "" {
+			class_name += "." + c.Genre
+		}
+		tc := junitTestCase{
+			Name:      c.Name,
+			ClassName: class_name,
+			Time:      c.Duration,
+			SystemOut: c.Stdout,
+			SystemErr: c.Stderr,
+		}
+		message := &junitMessage{Message: c.Message, Type: c.Status, Body: c.Stderr}
+		switch {
+		case c.Result == ResultSuccess:
+		case c.Result.unsolvable():
+			tc.Failure = message
+			suite.Failures++
+		case c.Result == ResultTestInterrupted || c.Result == ResultMaintenance:
+			tc.Skipped = &junitMessage{Message: c.Message, Type: c.Status}
+			suite.Skipped++
+		default:
+			tc.Error = message
+			suite.Errors++
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	suites := junitTestSuites{
+		Name:     "tsgctf-checker",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Errors:   suite.Errors,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Write the report to a file in the given format, "json" or "junit".
+// If the format is empty, it is inferred from the extension of the file.
+func (r *Report) WriteFile(path string, format string) error {
+	if format == "" {
+		format = "json"
+		if strings.EqualFold(filepath.Ext(path), ".xml") {
+			format = "junit"
+		}
+	}
+	var write func(io.Writer) error
+	switch format {
+	case "json":
+		write = r.WriteJSON
+	case "junit":
+		write = r.WriteJUnit
+	default:
+		return fmt.Errorf("Unknown report format: %s", format)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
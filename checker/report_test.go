@@ -0,0 +1,124 @@
+package checker
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func test_report() *Report {
+	challs := []Challenge{{Name: "solvable"}, {Name: "unsolvable"}, {Name: "broken-docker"}, {Name: "not-tested"}}
+	report := new_report("0123456789abcdef", challs)
+	report.record(challs[0], TestResultMessage{Result: ResultSuccess, Phase: PhaseRun, Stdout: "OK", RunTime: 2 * time.Second}, 1)
+	report.record(challs[1], TestResultMessage{Result: ResultFailure, Phase: PhaseRun, Errlog: "first", ExitCode: 1, RunTime: time.Second}, 1)
+	report.record(challs[1], TestResultMessage{Result: ResultTimeout, Phase: PhaseRun, Errlog: strings.Repeat("x", 10*reportExcerptSize), ExitCode: -1, RunTime: 3 * time.Second}, 2)
+	report.record(challs[2], TestResultMessage{Result: ResultInfraError, Phase: PhaseBuild, Errlog: "daemon down", ExitCode: -1}, 1)
+	report.FinishedAt = report.StartedAt.Add(10 * time.Second)
+	return report
+}
+
+func TestReport_Record(t *testing.T) {
+	report := test_report()
+
+	unsolvable := report.Challenges[1]
+	if unsolvable.Result != ResultTimeout || unsolvable.Attempts != 2 {
+		t.Errorf("Expected timeout in attempt 2, got %d in attempt %d", unsolvable.Result, unsolvable.Attempts)
+	}
+	if unsolvable.Duration != 4 || unsolvable.RunDuration != 3 {
+		t.Errorf("Expected duration 4 and run duration 3, got %v and %v", unsolvable.Duration, unsolvable.RunDuration)
+	}
+	if len(unsolvable.Stderr) > reportExcerptSize+64 {
+		t.Errorf("Expected stderr to be truncated, got %d bytes", len(unsolvable.Stderr))
+	}
+
+	not_tested := report.Challenges[3]
+	if not_tested.Result != ResultTestInterrupted || not_tested.Attempts != 0 {
+		t.Errorf("Expected untested challenge to be interrupted, got %d in attempt %d", not_tested.Result, not_tested.Attempts)
+	}
+	if report.Count(ResultSuccess) != 1 || report.Count(ResultTestInterrupted) != 1 {
+		t.Errorf("Unexpected counts: %d successes, %d interrupted", report.Count(ResultSuccess), report.Count(ResultTestInterrupted))
+	}
+}
+
+func TestReport_WriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := test_report().WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var got Report
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.RunID != "0123456789abcdef" || len(got.Challenges) != 4 {
+		t.Fatalf("Unexpected report: %+v", got)
+	}
+	if got.Challenges[0].Status != "success" || got.Challenges[0].Stdout != "OK" {
+		t.Errorf("Unexpected challenge: %+v", got.Challenges[0])
+	}
+}
+
+func TestReport_WriteJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	if err := test_report().WriteJUnit(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var got junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Tests != 4 || got.Failures != 1 || got.Errors != 1 || got.Skipped != 1 {
+		t.Errorf("Expected 4 tests, 1 failure, 1 error and 1 skipped, got %d, %d, %d and %d", got.Tests, got.Failures, got.Errors, got.Skipped)
+	}
+	cases := got.Suites[0].Cases
+	if cases[0].Failure != nil || cases[0].Error != nil || cases[0].Skipped != nil {
+		t.Errorf("Expected solvable challenge to pass: %+v", cases[0])
+	}
+	if cases[1].Failure == nil || cases[1].Failure.Type != "timeout" {
+		t.Errorf("Expected timeout failure: %+v", cases[1])
+	}
+	if cases[2].Error == nil || cases[2].Error.Body != "daemon down" {
+		t.Errorf("Expected infrastructure error: %+v", cases[2])
+	}
+	if cases[3].Skipped == nil {
+		t.Errorf("Expected untested challenge to be skipped: %+v", cases[3])
+	}
+}
+
+func TestReport_WriteFile(t *testing.T) {
+	dir := t.TempDir()
+	report := test_report()
+
+	tests := []struct {
+		file   string
+		format string
+		prefix string
+	}{
+		{"report.json", "", "{"},
+		{"report.xml", "", "<?xml"},
+		{"report.txt", "junit", "<?xml"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.file)
+		if err := report.WriteFile(path, tt.format); err != nil {
+			t.Fatal(err)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(content), tt.prefix) {
+			t.Errorf("[%s] Expected content starting with %q, got %q", tt.file, tt.prefix, content[:16])
+		}
+	}
+
+	if err := report.WriteFile(filepath.Join(dir, "report"), "yaml"); err == nil {
+		t.Errorf("Expected error for unknown format")
+	}
+}
@@ -0,0 +1,231 @@
+package checker
+
+// This file implements the endpoint of the Slack slash command and the "Re-run" button of alerts,
+// which run a test of a single challenge and reply with the result in a thread.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+	"go.uber.org/zap"
+)
+
+// Maximum size in bytes of a request from Slack.
+const slackRequestLimit = 64 * 1024
+
+// Maximum number of re-runs waiting for their turn.
+const slackRerunQueueSize = 16
+
+// Run a test of a single challenge, and return the report of the test cycle.
+type RerunFunc func(ctx context.Context, chall_name string) (*Report, error)
+
+// A re-run requested from Slack.
+type slackRerun struct {
+	chall_name string
+	user       string
+	channel    string
+	thread_ts  string // "" to start a new thread
+}
+
+// HTTP handler of the slash command and the "Re-run" button.
+// Requests are verified with the signing secret of the Slack app,
+// and re-runs are queued to be run one by one by Run.
+type SlackCommandHandler struct {
+	logger  *zap.SugaredLogger
+	secret  string
+	api     *slack.Client
+	rerun   RerunFunc
+	queue   chan slackRerun
+	mu      sync.Mutex
+	pending map[string]bool // challenges queued or running
+}
+
+func NewSlackCommandHandler(logger *zap.SugaredLogger, secret string, token string, rerun RerunFunc, options ...slack.Option) *SlackCommandHandler {
+	options = append([]slack.Option{slack.OptionHTTPClient(new_http_client())}, options...)
+	return &SlackCommandHandler{
+		logger:  logger,
+		secret:  secret,
+		api:     slack.New(token, options...),
+		rerun:   rerun,
+		queue:   make(chan slackRerun, slackRerunQueueSize),
+		pending: make(map[string]bool),
+	}
+}
+
+// Check the signature and the timestamp of a request from Slack.
+func (h *SlackCommandHandler) verify(header http.Header, body []byte) error {
+	verifier, err := slack.NewSecretsVerifier(header, h.secret)
+	if err != nil {
+		return err
+	}
+	if _, err := verifier.Write(body); err != nil {
+		return err
+	}
+	return verifier.Ensure()
+}
+
+func (h *SlackCommandHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed.", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, slackRequestLimit))
+	if err != nil {
+		http.Error(w, "Failed to read the request.", http.StatusBadRequest)
+		return
+	}
+	if err := h.verify(r.Header, body); err != nil {
+		h.logger.Warnw("Rejected a request with invalid signature", "remote", r.RemoteAddr, "error", err)
+		http.Error(w, "Invalid signature.", http.StatusUnauthorized)
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "Invalid form.", http.StatusBadRequest)
+		return
+	}
+
+	if payload := form.Get("payload"); payload != "" {
+		h.handle_interaction(w, payload)
+	} else {
+		h.handle_command(w, form)
+	}
+}
+
+// Handle a slash command, eg: `/checker rerun <challenge>` or `/rerun <challenge>`.
+// The reply is shown only to the user, and the result is posted to the channel.
+func (h *SlackCommandHandler) handle_command(w http.ResponseWriter, form url.Values) {
+	args := strings.Fields(form.Get("text"))
+	if len(args) > 0 && args[0] == "rerun" {
+		args = args[1:]
+	}
+	if len(args) != 1 || strings.Contains(args[0], ",") {
+		reply_ephemeral(w, fmt.Sprintf("Usage: `%s rerun <challenge>`", form.Get("command")))
+		return
+	}
+
+	rerun := slackRerun{chall_name: args[0], user: form.Get("user_id"), channel: form.Get("channel_id")}
+	reply_ephemeral(w, h.enqueue(rerun))
+}
+
+// Handle a click of the "Re-run" button. The result is posted in the thread of the alert.
+func (h *SlackCommandHandler) handle_interaction(w http.ResponseWriter, payload string) {
+	var callback slack.InteractionCallback
+	if err := json.Unmarshal([]byte(payload), &callback); err != nil {
+		http.Error(w, "Invalid payload.", http.StatusBadRequest)
+		return
+	}
+	if callback.Type != slack.InteractionTypeBlockActions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	for _, action := range callback.ActionCallback.BlockActions {
+		if action.ActionID != slackRerunAction {
+			continue
+		}
+		thread_ts := callback.Container.ThreadTs
+		if thread_ts == "" {
+			thread_ts = callback.Container.MessageTs
+		}
+		msg := h.enqueue(slackRerun{chall_name: action.Value, user: callback.User.ID, channel: callback.Channel.ID, thread_ts: thread_ts})
+		h.logger.Infof("[%s] Re-run requested by %s: %s", action.Value, callback.User.ID, msg)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Queue a re-run unless the challenge is already queued, and return the message to the user.
+func (h *SlackCommandHandler) enqueue(rerun slackRerun) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.pending[rerun.chall_name] {
+		return fmt.Sprintf("Re-run of `%s` is already queued.", rerun.chall_name)
+	}
+	select {
+	case h.queue <- rerun:
+		h.pending[rerun.chall_name] = true
+		return fmt.Sprintf("Re-run of `%s` is queued.", rerun.chall_name)
+	default:
+		return "Too many re-runs are queued. Try again later."
+	}
+}
+
+// Run queued re-runs one by one until ctx is cancelled.
+func (h *SlackCommandHandler) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case rerun := <-h.queue:
+			h.run(ctx, rerun)
+			h.mu.Lock()
+			delete(h.pending, rerun.chall_name)
+			h.mu.Unlock()
+		}
+	}
+}
+
+// Run a re-run and reply with the result in the thread.
+func (h *SlackCommandHandler) run(ctx context.Context, rerun slackRerun) {
+	start := fmt.Sprintf(":repeat: Re-running `%s` requested by <@%s>", rerun.chall_name, rerun.user)
+	options := []slack.MsgOption{slack.MsgOptionText(start, false), slack_params(":repeat:")}
+	if rerun.thread_ts != "" {
+		options = append(options, slack.MsgOptionTS(rerun.thread_ts))
+	}
+	channel, ts, err := h.api.PostMessage(rerun.channel, options...)
+	if err != nil {
+		h.logger.Errorw("Failed to send slack message", "challenge", rerun.chall_name, "error", err)
+		return
+	}
+	if rerun.thread_ts == "" {
+		rerun.thread_ts = ts
+	}
+
+	h.logger.Infof("[%s] Re-running requested by %s.", rerun.chall_name, rerun.user)
+	report, err := h.rerun(ctx, rerun.chall_name)
+	msg := rerun_message(rerun.chall_name, report, err)
+	icon := ":white_check_mark:"
+	if err != nil || len(report.Challenges) != 1 || report.Challenges[0].Result != ResultSuccess {
+		icon = ":fire:"
+	}
+
+	_, _, err = h.api.PostMessage(channel, slack.MsgOptionText(msg, false), slack.MsgOptionTS(rerun.thread_ts), slack_params(icon))
+	if err != nil {
+		h.logger.Errorw("Failed to send slack message", "challenge", rerun.chall_name, "error", err)
+	}
+}
+
+// Markdown message of the result of a re-run.
+func rerun_message(chall_name string, report *Report, err error) string {
+	switch {
+	case err != nil:
+		return fmt.Sprintf("Re-run of `%s` failed: %v", chall_name, err)
+	case report.Interrupted:
+		return fmt.Sprintf("Re-run of `%s` was interrupted.", chall_name)
+	case len(report.Challenges) == 0:
+		return fmt.Sprintf("Challenge `%s` is not found.", chall_name)
+	}
+
+	chall := report.Challenges[0]
+	msg := fmt.Sprintf("Re-run of `%s` finished: `%s` (%d attempts, %v)", chall.Name, chall.Message, chall.Attempts, (time.Duration(chall.Duration * float64(time.Second))).Round(time.Second))
+	if chall.Result != ResultSuccess && chall.Stderr != "" {
+		msg += fmt.Sprintf("\nSTDERR:\n```\n%s\n```", chall.Stderr)
+	}
+	return msg
+}
+
+// Respond to a slash command with a message shown only to the user.
+func reply_ephemeral(w http.ResponseWriter, text string) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(map[string]string{"response_type": "ephemeral", "text": text})
+}
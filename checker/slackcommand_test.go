@@ -0,0 +1,177 @@
+package checker
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSlackSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+// Create a request signed with testSlackSecret.
+func signed_slack_request(body string, timestamp time.Time) *http.Request {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(testSlackSecret))
+	fmt.Fprintf(mac, "v0:%s:%s", ts, body)
+
+	req := httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Slack-Request-Timestamp", ts)
+	req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+func create_command_handler(t *testing.T, slack *fakeSlack, reruns chan<- string) *SlackCommandHandler {
+	rerun := func(ctx context.Context, chall_name string) (*Report, error) {
+		reruns <- chall_name
+		report := new_report("0123456789ab", []Challenge{{Name: chall_name}})
+		report.record(Challenge{Name: chall_name}, TestResultMessage{Result: ResultSuccess, Phase: PhaseRun}, 1)
+		return report, nil
+	}
+	handler := NewSlackCommandHandler(create_logger(), testSlackSecret, "xoxb-test", rerun, slack.api_option())
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go handler.Run(ctx)
+	return handler
+}
+
+// Wait until the fake Slack receives n requests.
+func (s *fakeSlack) wait(t *testing.T, n int) {
+	for i := 0; i < 100; i++ {
+		s.mu.Lock()
+		received := len(s.methods)
+		s.mu.Unlock()
+		if received >= n {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("Expected %d requests to Slack, got %v", n, s.methods)
+}
+
+func TestSlackCommandHandler_Signature(t *testing.T) {
+	slack := new_fake_slack(t)
+	handler := create_command_handler(t, slack, make(chan string, 1))
+	body := "command=%2Fchecker&text=rerun+test-chall&user_id=U012345&channel_id=C012345"
+
+	tests := []struct {
+		name string
+		req  *http.Request
+	}{
+		{"tampered", signed_slack_request(body, time.Now())},
+		{"expired", signed_slack_request(body, time.Now().Add(-10*time.Minute))},
+		{"unsigned", httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader(body))},
+	}
+	tests[0].req.Body = http.NoBody
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, tt.req)
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("Expected 401, got %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestSlackCommandHandler_Command(t *testing.T) {
+	slack := new_fake_slack(t)
+	reruns := make(chan string, 1)
+	handler := create_command_handler(t, slack, reruns)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, signed_slack_request("command=%2Fchecker&text=rerun", time.Now()))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Usage: `/checker rerun <challenge>`") {
+		t.Errorf("Expected usage, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, signed_slack_request("command=%2Fchecker&text=rerun+test-chall&user_id=U012345&channel_id=C012345", time.Now()))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "is queued") {
+		t.Fatalf("Unexpected response: %d %s", w.Code, w.Body.String())
+	}
+	if name := <-reruns; name != "test-chall" {
+		t.Errorf("Unexpected challenge re-run: %s", name)
+	}
+
+	// the result is replied in the thread of the message announcing the re-run
+	slack.wait(t, 2)
+	if slack.forms[0].Get("channel") != "C012345" || slack.forms[0].Get("thread_ts") != "" || !strings.Contains(slack.forms[0].Get("text"), "<@U012345>") {
+		t.Errorf("Unexpected message of the re-run: %v", slack.forms[0])
+	}
+	if slack.forms[1].Get("thread_ts") != "1000.0001" || !strings.Contains(slack.forms[1].Get("text"), "`Solvable`") {
+		t.Errorf("Unexpected reply of the result: %v", slack.forms[1])
+	}
+}
+
+func TestSlackCommandHandler_Button(t *testing.T) {
+	slack := new_fake_slack(t)
+	reruns := make(chan string, 1)
+	handler := create_command_handler(t, slack, reruns)
+
+	payload, _ := json.Marshal(map[string]any{
+		"type":      "block_actions",
+		"user":      map[string]string{"id": "U012345"},
+		"channel":   map[string]string{"id": "C012345"},
+		"container": map[string]string{"type": "message", "message_ts": "2000.0002", "channel_id": "C012345"},
+		"actions":   []map[string]string{{"type": "button", "action_id": slackRerunAction, "block_id": slackRerunAction, "value": "test-chall"}},
+	})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, signed_slack_request("payload="+url.QueryEscape(string(payload)), time.Now()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected response: %d %s", w.Code, w.Body.String())
+	}
+	if name := <-reruns; name != "test-chall" {
+		t.Errorf("Unexpected challenge re-run: %s", name)
+	}
+
+	// both messages are posted in the thread of the alert
+	slack.wait(t, 2)
+	for _, form := range slack.forms[:2] {
+		if form.Get("thread_ts") != "2000.0002" {
+			t.Errorf("Message should be posted in the thread of the alert: %v", form)
+		}
+	}
+}
+
+func TestSlackNotifier_RerunButton(t *testing.T) {
+	slack := new_fake_slack(t)
+	notifier := slack.create_notifier()
+	notifier.rerun_button = true
+
+	n := test_notification()
+	n.Kind = NotifyAlert
+	if err := notifier.Notify(n); err != nil {
+		t.Fatal(err)
+	}
+	blocks := slack.forms[0].Get("blocks")
+	if !strings.Contains(blocks, `"action_id":"rerun"`) || !strings.Contains(blocks, `"value":"test-chall"`) {
+		t.Errorf("Summary should have the Re-run button: %s", blocks)
+	}
+}
+
+func TestRerunMessage(t *testing.T) {
+	report := new_report("0123456789ab", []Challenge{{Name: "test-chall"}})
+	report.record(Challenge{Name: "test-chall"}, TestResultMessage{Result: ResultFailure, Phase: PhaseRun, Errlog: "assertion failed"}, 2)
+
+	msg := rerun_message("test-chall", report, nil)
+	if !strings.Contains(msg, "`Unsolvable`") || !strings.Contains(msg, "assertion failed") {
+		t.Errorf("Unexpected message: %s", msg)
+	}
+	if msg := rerun_message("missing", new_report("0123456789ab", nil), nil); msg != "Challenge `missing` is not found." {
+		t.Errorf("Unexpected message: %s", msg)
+	}
+	if msg := rerun_message("test-chall", nil, fmt.Errorf("Result store is nil")); !strings.Contains(msg, "Result store is nil") {
+		t.Errorf("Unexpected message: %s", msg)
+	}
+}
@@ -1,41 +1,281 @@
 package checker
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/slack-go/slack"
 	"go.uber.org/zap"
 )
 
+// Outputs longer than this are uploaded as files instead of inlined in the thread.
+const slackInlineLogSize = 2000
+
+// Action ID of the "Re-run" button attached to alerts, handled by SlackCommandHandler.
+const slackRerunAction = "rerun"
+
 type SlackNotifier struct {
 	api     *slack.Client
 	channel string
 	logger  *zap.SugaredLogger
+	threads slackThreadStore
+	// attach the "Re-run" button to alerts
+	rerun_button bool
+}
+
+// Storage of the threads of open alerts, under which follow-ups are threaded.
+// ResultStore persists them, so that one-shot runs and restarted daemons thread under the original alert.
+type slackThreadStore interface {
+	RecordSlackThread(thread DbSlackThread) error
+	FetchSlackThread(channel string, chall_name string) (DbSlackThread, error)
+	DeleteSlackThread(channel string, chall_name string) error
+}
+
+// Threads kept in memory of a notifier, used when no result store is available such as in dry runs.
+type memorySlackThreads struct {
+	mu      sync.Mutex
+	threads map[string]DbSlackThread
+}
+
+func new_memory_slack_threads() *memorySlackThreads {
+	return &memorySlackThreads{threads: make(map[string]DbSlackThread)}
+}
+
+func (t *memorySlackThreads) RecordSlackThread(thread DbSlackThread) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.threads[thread.Channel+"/"+thread.Challenge] = thread
+	return nil
+}
+
+func (t *memorySlackThreads) FetchSlackThread(channel string, chall_name string) (DbSlackThread, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	thread, ok := t.threads[channel+"/"+chall_name]
+	if !ok {
+		return thread, sql.ErrNoRows
+	}
+	return thread, nil
 }
 
-func NewSlackNotifier(token string, channel string, logger *zap.SugaredLogger) *SlackNotifier {
+func (t *memorySlackThreads) DeleteSlackThread(channel string, chall_name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.threads, channel+"/"+chall_name)
+	return nil
+}
+
+func NewSlackNotifier(token string, channel string, logger *zap.SugaredLogger, options ...slack.Option) *SlackNotifier {
+	options = append([]slack.Option{slack.OptionHTTPClient(new_http_client())}, options...)
 	return &SlackNotifier{
-		api:     slack.New(token),
+		api:     slack.New(token, options...),
 		channel: channel,
 		logger:  logger,
+		threads: new_memory_slack_threads(),
 	}
 }
 
+// Thread of the open alert of a challenge. Failures to read it are logged and regarded as no thread.
+func (s *SlackNotifier) open_thread(chall_name string) (DbSlackThread, bool) {
+	thread, err := s.threads.FetchSlackThread(s.channel, chall_name)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			s.logger.Warnw("Failed to read slack thread", "challenge", chall_name, "error", err)
+		}
+		return thread, false
+	}
+	return thread, true
+}
+
+func (s *SlackNotifier) Notify(n Notification) error {
+	if n.Kind == NotifyRecovery {
+		return s.NotifyRecovery(n)
+	}
+	return s.notify_alert(n)
+}
+
+// Notify a failed test.
+// The assignee is mentioned unless the test failed due to troubles of the checker infrastructure,
+// so that challenge authors are not paged for Docker daemon or registry outages.
 func (s *SlackNotifier) NotifyError(chall Challenge, result TestResult, stdout string, errlog string) error {
-	args := slack.PostMessageParameters{
+	return s.notify_alert(Notification{Kind: NotifyAlert, Chall: chall, Result: result, Stdout: stdout, Errlog: errlog, Failures: 1})
+}
+
+func slack_params(icon string) slack.MsgOption {
+	return slack.MsgOptionPostMessageParameters(slack.PostMessageParameters{
 		Username:  "TSGCTF Status",
-		IconEmoji: ":fire:",
+		IconEmoji: icon,
 		Markdown:  true,
+	})
+}
+
+// Post a short summary of an alert, and its details in the thread.
+// If the challenge already has an open alert, the summary is updated in place instead.
+func (s *SlackNotifier) notify_alert(n Notification) error {
+	icon := ":fire:"
+	if n.Result == ResultInfraError {
+		icon = ":construction:"
 	}
-	stdout = fmt.Sprintf("```\n%s\n```", stdout)
-	errlog = fmt.Sprintf("```\n%s\n```", errlog)
-	msg := fmt.Sprintf("Status check failed for `%s`\n"+"Result: `%s`\n"+"Asignee: <@%s>\nSTDOUT:\n%s\nSTDERR:\n%s\n", chall.Name, result.ToMessage(), chall.Assignee, stdout, errlog)
+	summary := s.summary_options(n)
 
-	_, _, err := s.api.PostMessage(s.channel, slack.MsgOptionText(msg, false), slack.MsgOptionPostMessageParameters(args))
-	if err != nil {
-		s.logger.Errorf("Failed to send slack message: %s", err)
+	thread, ok := s.open_thread(n.Chall.Name)
+	if ok {
+		if _, _, _, err := s.api.UpdateMessage(thread.ChannelID, thread.TS, summary...); err != nil {
+			s.logger.Warnf("Failed to update slack message, posting a new one: %s", err)
+			ok = false
+		}
+	}
+	if !ok {
+		channel_id, ts, err := s.api.PostMessage(s.channel, append(summary, slack_params(icon))...)
+		if err != nil {
+			s.logger.Errorf("Failed to send slack message: %s", err)
+			return err
+		}
+		thread = DbSlackThread{Channel: s.channel, Challenge: n.Chall.Name, ChannelID: channel_id, TS: ts}
+		if err := s.threads.RecordSlackThread(thread); err != nil {
+			s.logger.Warnw("Failed to record slack thread", "challenge", n.Chall.Name, "error", err)
+		}
+	}
+
+	if err := s.post_details(thread, n, icon); err != nil {
+		s.logger.Errorf("Failed to send details to slack thread: %s", err)
 		return err
 	}
+	return nil
+}
+
+// Message options of the summary of an alert, with the "Re-run" button if enabled.
+func (s *SlackNotifier) summary_options(n Notification) []slack.MsgOption {
+	summary := alert_summary(n)
+	options := []slack.MsgOption{slack.MsgOptionText(summary, false)}
+	// the health of the checker has no challenge to re-run
+	if s.rerun_button && n.Chall.Name != "" {
+		button := slack.NewButtonBlockElement(slackRerunAction, n.Chall.Name, slack.NewTextBlockObject(slack.PlainTextType, "Re-run", false, false))
+		options = append(options, slack.MsgOptionBlocks(
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, summary, false, false), nil, nil),
+			slack.NewActionBlock(slackRerunAction, button),
+		))
+	}
+	return options
+}
+
+// Post stdout/stderr of a failed test in the thread. Long outputs are uploaded as files.
+func (s *SlackNotifier) post_details(thread DbSlackThread, n Notification, icon string) error {
+	logs := []struct {
+		name    string
+		content string
+	}{
+		{"stdout", n.Stdout},
+		{"stderr", n.Errlog},
+	}
+	if n.Result == ResultBuildFailure {
+		logs = logs[1:]
+		logs[0].name = "build log"
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "Result: `%s` (test cycle `%s`, attempt %d)\n", n.Result.ToMessage(), n.RunID, n.Attempt)
+	uploads := logs[:0:0]
+	for _, log := range logs {
+		if len(log.content) > slackInlineLogSize {
+			fmt.Fprintf(&msg, "%s: uploaded as a file (%d bytes)\n", strings.ToUpper(log.name), len(log.content))
+			uploads = append(uploads, log)
+			continue
+		}
+		fmt.Fprintf(&msg, "%s:\n```\n%s\n```\n", strings.ToUpper(log.name), log.content)
+	}
 
+	if _, _, err := s.api.PostMessage(thread.ChannelID, slack.MsgOptionText(msg.String(), false), slack.MsgOptionTS(thread.TS), slack_params(icon)); err != nil {
+		return err
+	}
+	for _, log := range uploads {
+		_, err := s.api.UploadFileV2(slack.UploadFileV2Parameters{
+			Reader:          strings.NewReader(log.content),
+			FileSize:        len(log.content),
+			Filename:        fmt.Sprintf("%s-%s-%d-%s.txt", n.Chall.Name, n.RunID, n.Attempt, strings.ReplaceAll(log.name, " ", "-")),
+			Title:           fmt.Sprintf("%s of %s", log.name, n.Chall.Name),
+			Channel:         thread.ChannelID,
+			ThreadTimestamp: thread.TS,
+		})
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// Notify that a challenge became solvable again.
+// The recovery is posted in the thread of the open alert and also sent to the channel.
+func (s *SlackNotifier) NotifyRecovery(n Notification) error {
+	msg := recovery_message(n)
+	options := []slack.MsgOption{slack.MsgOptionText(msg, false), slack_params(":white_check_mark:")}
+	channel := s.channel
+	if thread, ok := s.open_thread(n.Chall.Name); ok {
+		summary := fmt.Sprintf(":white_check_mark: ~%s~\nRecovered at %s", alert_summary(n), n.Timestamp.UTC().Format("01/02 15:04:05 UTC"))
+		if _, _, _, err := s.api.UpdateMessage(thread.ChannelID, thread.TS, slack.MsgOptionText(summary, false)); err != nil {
+			s.logger.Warnf("Failed to update slack message: %s", err)
+		}
+		channel = thread.ChannelID
+		options = append(options, slack.MsgOptionTS(thread.TS), slack.MsgOptionBroadcast())
+		if err := s.threads.DeleteSlackThread(s.channel, n.Chall.Name); err != nil {
+			s.logger.Warnw("Failed to delete slack thread", "challenge", n.Chall.Name, "error", err)
+		}
+	}
+
+	if _, _, err := s.api.PostMessage(channel, options...); err != nil {
+		s.logger.Errorf("Failed to send slack message: %s", err)
+		return err
+	}
+	return nil
+}
+
+// One-line summary of an alert posted to the channel.
+func alert_summary(n Notification) string {
+	var summary string
+	switch {
+	case n.Chall.Name == "" && len(n.Affected) == 0:
+		summary = "Status checks could not run due to checker infrastructure error"
+	case n.Chall.Name == "":
+		summary = fmt.Sprintf("Status checks could not run for %d challenges due to checker infrastructure error: `%s`", len(n.Affected), strings.Join(n.Affected, "`, `"))
+	case n.Result == ResultInfraError:
+		summary = fmt.Sprintf("Status check could not run for `%s` due to checker infrastructure error", n.Chall.Name)
+	case n.Result == ResultBuildFailure:
+		summary = fmt.Sprintf("Solver build failed for `%s`", n.Chall.Name)
+	default:
+		summary = fmt.Sprintf("Status check failed for `%s`: `%s`", n.Chall.Name, n.Result.ToMessage())
+	}
+	if n.Result != ResultInfraError && n.Chall.Assignee != "" {
+		summary += fmt.Sprintf(" (Asignee: <@%s>)", n.Chall.Assignee)
+	}
+	if n.Failures > 1 && n.Kind != NotifyRecovery {
+		summary += fmt.Sprintf("\nFailing for %d test cycles since %s", n.Failures, n.BrokenSince.UTC().Format("01/02 15:04:05 UTC"))
+	}
+	return summary
+}
+
+// Markdown message of a recovery shared by Slack and Discord.
+func recovery_message(n Notification) string {
+	if n.Chall.Name == "" {
+		return fmt.Sprintf("Checker infrastructure recovered\n"+"Broken for %v (%d test cycles)\n", n.Timestamp.Sub(n.BrokenSince).Round(time.Second), n.Failures)
+	}
+	return fmt.Sprintf("Status check recovered for `%s`\n"+"Result: `%s`\n"+"Broken for %v (%d test cycles)\n", n.Chall.Name, n.Result.ToMessage(), n.Timestamp.Sub(n.BrokenSince).Round(time.Second), n.Failures)
+}
+
+// Markdown message of a failed test used by Discord.
+func notification_message(chall Challenge, result TestResult, stdout string, errlog string, mention string) string {
+	stdout = fmt.Sprintf("```\n%s\n```", stdout)
+	errlog = fmt.Sprintf("```\n%s\n```", errlog)
+
+	switch result {
+	case ResultInfraError:
+		return fmt.Sprintf("Status check could not run for `%s` due to checker infrastructure error\n"+"Result: `%s`\nSTDOUT:\n%s\nSTDERR:\n%s\n", chall.Name, result.ToMessage(), stdout, errlog)
+	case ResultBuildFailure:
+		return fmt.Sprintf("Solver build failed for `%s`\n"+"Result: `%s`\n"+"Asignee: %s\nBuild log:\n%s\n", chall.Name, result.ToMessage(), mention, errlog)
+	default:
+		return fmt.Sprintf("Status check failed for `%s`\n"+"Result: `%s`\n"+"Asignee: %s\nSTDOUT:\n%s\nSTDERR:\n%s\n", chall.Name, result.ToMessage(), mention, stdout, errlog)
+	}
+}
@@ -0,0 +1,206 @@
+package checker
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// Local stand-in of Slack API recording the called methods and their forms.
+type fakeSlack struct {
+	server  *httptest.Server
+	mu      sync.Mutex
+	methods []string
+	forms   []url.Values
+}
+
+func new_fake_slack(t *testing.T) *fakeSlack {
+	s := &fakeSlack{}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		form, _ := url.ParseQuery(string(body))
+		method := strings.TrimPrefix(req.URL.Path, "/")
+		s.mu.Lock()
+		s.methods = append(s.methods, method)
+		s.forms = append(s.forms, form)
+		s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		switch method {
+		case "chat.postMessage", "chat.update":
+			io.WriteString(w, `{"ok": true, "channel": "C012345", "ts": "1000.0001"}`)
+		case "files.getUploadURLExternal":
+			io.WriteString(w, `{"ok": true, "upload_url": "`+s.server.URL+`/upload", "file_id": "F012345"}`)
+		case "files.completeUploadExternal":
+			io.WriteString(w, `{"ok": true, "files": [{"id": "F012345", "title": "log"}]}`)
+		default:
+			io.WriteString(w, `{"ok": true}`)
+		}
+	}))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// Option of clients to send requests to the fake.
+func (s *fakeSlack) api_option() slack.Option {
+	return slack.OptionAPIURL(s.server.URL + "/")
+}
+
+func (s *fakeSlack) create_notifier() *SlackNotifier {
+	notifier, _ := NewNotifier(NotifierConfig{Type: "slack", Token: "xoxb-test", Channel: "#status", APIURL: s.server.URL + "/"}, create_logger())
+	return notifier.(*SlackNotifier)
+}
+
+func (s *fakeSlack) reset() {
+	s.methods = nil
+	s.forms = nil
+}
+
+func TestSlackNotifier_Thread(t *testing.T) {
+	slack := new_fake_slack(t)
+	notifier := slack.create_notifier()
+
+	n := test_notification()
+	n.Kind = NotifyAlert
+	n.Failures = 1
+	if err := notifier.Notify(n); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(slack.methods, ",") != "chat.postMessage,chat.postMessage" {
+		t.Fatalf("Unexpected methods of the first alert: %v", slack.methods)
+	}
+	if slack.forms[0].Get("thread_ts") != "" || slack.forms[0].Get("channel") != "#status" {
+		t.Errorf("Summary should be posted to the channel: %v", slack.forms[0])
+	}
+	if strings.Contains(slack.forms[0].Get("text"), "stdout") {
+		t.Errorf("Summary should not contain outputs: %s", slack.forms[0].Get("text"))
+	}
+	details := slack.forms[1]
+	if details.Get("thread_ts") != "1000.0001" || details.Get("channel") != "C012345" || !strings.Contains(details.Get("text"), "stderr \"quoted\"") {
+		t.Errorf("Details should be posted in the thread: %v", details)
+	}
+
+	// follow-up failure updates the summary in place
+	slack.reset()
+	n.Failures = 3
+	n.BrokenSince = n.Timestamp.Add(-10 * time.Minute)
+	if err := notifier.Notify(n); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(slack.methods, ",") != "chat.update,chat.postMessage" {
+		t.Fatalf("Unexpected methods of the re-alert: %v", slack.methods)
+	}
+	if slack.forms[0].Get("ts") != "1000.0001" || !strings.Contains(slack.forms[0].Get("text"), "Failing for 3 test cycles") {
+		t.Errorf("Unexpected update of the summary: %v", slack.forms[0])
+	}
+	if slack.forms[1].Get("thread_ts") != "1000.0001" {
+		t.Errorf("Details of the re-alert should be posted in the thread: %v", slack.forms[1])
+	}
+
+	// recovery closes the thread
+	slack.reset()
+	n.Kind = NotifyRecovery
+	n.Result = ResultSuccess
+	if err := notifier.Notify(n); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(slack.methods, ",") != "chat.update,chat.postMessage" {
+		t.Fatalf("Unexpected methods of the recovery: %v", slack.methods)
+	}
+	if slack.forms[1].Get("thread_ts") != "1000.0001" || slack.forms[1].Get("reply_broadcast") != "true" {
+		t.Errorf("Recovery should be broadcast from the thread: %v", slack.forms[1])
+	}
+	if _, ok := notifier.open_thread(n.Chall.Name); ok {
+		t.Errorf("Thread should be closed after the recovery")
+	}
+
+	// next alert starts a new thread
+	slack.reset()
+	n.Kind = NotifyAlert
+	n.Result = ResultFailure
+	if err := notifier.Notify(n); err != nil {
+		t.Fatal(err)
+	}
+	if slack.methods[0] != "chat.postMessage" || slack.forms[0].Get("thread_ts") != "" {
+		t.Errorf("New alert should be posted to the channel: %v %v", slack.methods, slack.forms)
+	}
+}
+
+func TestSlackNotifier_PersistentThread(t *testing.T) {
+	slack := new_fake_slack(t)
+	store := create_sqlite_store(t)
+	conf := CheckerConfig{Notifiers: []NotifierConfig{{Type: "slack", Token: "xoxb-test", Channel: "#status", APIURL: slack.server.URL + "/"}}}
+	// a notifier of each run, eg: one-shot runs by cron
+	create_notifier := func() Notifier {
+		notifiers, err := NewNotifiers(conf, create_logger(), store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return notifiers[0]
+	}
+
+	n := test_notification()
+	n.Kind = NotifyAlert
+	if err := create_notifier().Notify(n); err != nil {
+		t.Fatal(err)
+	}
+
+	// follow-up of the next run updates the original alert
+	slack.reset()
+	if err := create_notifier().Notify(n); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(slack.methods, ",") != "chat.update,chat.postMessage" || slack.forms[0].Get("ts") != "1000.0001" {
+		t.Fatalf("Follow-up should update the original alert: %v %v", slack.methods, slack.forms)
+	}
+
+	// recovery of the next run is threaded under the original alert
+	slack.reset()
+	n.Kind = NotifyRecovery
+	n.Result = ResultSuccess
+	if err := create_notifier().Notify(n); err != nil {
+		t.Fatal(err)
+	}
+	if slack.forms[1].Get("thread_ts") != "1000.0001" {
+		t.Errorf("Recovery should be posted in the original thread: %v", slack.forms[1])
+	}
+	if _, err := store.FetchSlackThread("#status", n.Chall.Name); err != sql.ErrNoRows {
+		t.Errorf("Thread should be deleted after the recovery: %v", err)
+	}
+}
+
+func TestSlackNotifier_Upload(t *testing.T) {
+	slack := new_fake_slack(t)
+	notifier := slack.create_notifier()
+
+	n := test_notification()
+	n.Kind = NotifyAlert
+	n.Stdout = strings.Repeat("A", slackInlineLogSize+1)
+	if err := notifier.Notify(n); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "chat.postMessage,chat.postMessage,files.getUploadURLExternal,upload,files.completeUploadExternal"
+	if strings.Join(slack.methods, ",") != want {
+		t.Fatalf("Unexpected methods: %v", slack.methods)
+	}
+	details := slack.forms[1].Get("text")
+	if strings.Contains(details, "AAAA") || !strings.Contains(details, "stderr \"quoted\"") {
+		t.Errorf("Only short outputs should be inlined: %s", details)
+	}
+	if slack.forms[2].Get("filename") != "test-chall-0123456789abcdef-2-stdout.txt" {
+		t.Errorf("Unexpected filename: %v", slack.forms[2])
+	}
+	complete := slack.forms[4]
+	if complete.Get("channel_id") != "C012345" || complete.Get("thread_ts") != "1000.0001" {
+		t.Errorf("File should be shared in the thread: %v", complete)
+	}
+}
@@ -0,0 +1,232 @@
+package checker
+
+// This file implements the writer of results which survives failures of the result store.
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Default file where results are spooled while the result store is unavailable.
+const DefaultSpoolFile = "checker-spool.jsonl"
+
+// Number of attempts to write a result before spooling it.
+const writeAttempts = 3
+
+// Backoff before the first retry of a write, doubled on each retry.
+const writeRetryBackoff = 1 * time.Second
+
+// A result waiting to be written to the result store.
+// Exactly one of Test and Build is set.
+type spoolEntry struct {
+	Test  *spoolTestResult `json:"test,omitempty"`
+	Build *DbBuildResult   `json:"build,omitempty"`
+}
+
+type spoolTestResult struct {
+	Name    string            `json:"name"`
+	Genre   string            `json:"genre,omitempty"`
+	Result  TestResultMessage `json:"result"`
+	RunID   string            `json:"run_id"`
+	Attempt uint              `json:"attempt"`
+}
+
+// Write an entry to the result store.
+func (entry spoolEntry) write(store ResultStore) error {
+	switch {
+	case entry.Test != nil:
+		chall := Challenge{Name: entry.Test.Name, Genre: entry.Test.Genre}
+		return store.RecordResult(chall, entry.Test.Result, entry.Test.RunID, entry.Test.Attempt)
+	case entry.Build != nil:
+		return store.RecordBuildResult(*entry.Build)
+	default:
+		return errors.New("Empty spool entry")
+	}
+}
+
+// Asynchronous writer of results.
+// Writes are retried with backoff, and results which cannot be written are appended to the spool file,
+// which is replayed on the next test cycle. Enqueueing never fails, and blocks only if the queue is full,
+// so that a trouble of the result store never stops tests.
+type resultWriter struct {
+	logger     *zap.SugaredLogger
+	store      ResultStore
+	spool_file string
+	queue      chan spoolEntry
+	wg         sync.WaitGroup
+	backoff    time.Duration
+	// the last write failed. Retries are skipped until a write succeeds,
+	// so that results are spooled quickly while the result store is down.
+	degraded  bool
+	num_spool int
+}
+
+// Start a writer which can buffer `capacity` results without blocking.
+func new_result_writer(logger *zap.SugaredLogger, store ResultStore, spool_file string, capacity int) *resultWriter {
+	if spool_file == "" {
+		spool_file = DefaultSpoolFile
+	}
+	w := &resultWriter{
+		logger:     logger,
+		store:      store,
+		spool_file: spool_file,
+		queue:      make(chan spoolEntry, capacity),
+		backoff:    writeRetryBackoff,
+	}
+	w.wg.Add(1)
+	go w.run()
+	return w
+}
+
+func (w *resultWriter) run() {
+	defer w.wg.Done()
+	for entry := range w.queue {
+		if err := w.write_with_retry(entry); err != nil {
+			w.logger.Errorw("Failed to record result. Spooling it to file.", "error", err, "spool", w.spool_file)
+			if err := append_spool(w.spool_file, entry); err != nil {
+				w.logger.Errorw("Failed to spool result. The result is lost.", "error", err, "entry", entry)
+				continue
+			}
+			w.num_spool++
+		}
+	}
+}
+
+func (w *resultWriter) write_with_retry(entry spoolEntry) error {
+	attempts := writeAttempts
+	if w.degraded {
+		attempts = 1
+	}
+	backoff := w.backoff
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = entry.write(w.store); err == nil {
+			w.degraded = false
+			return nil
+		}
+		if attempt < attempts {
+			w.logger.Warnw("Failed to record result. Retrying.", "error", err, "attempt", attempt, "backoff", backoff)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	w.degraded = true
+	return err
+}
+
+// Enqueue a test result.
+func (w *resultWriter) record_result(chall Challenge, result TestResultMessage, run_id string, attempt uint) {
+	w.enqueue(spoolEntry{Test: &spoolTestResult{Name: chall.Name, Genre: chall.Genre, Result: result, RunID: run_id, Attempt: attempt}})
+}
+
+// Enqueue a build result.
+func (w *resultWriter) record_build(result DbBuildResult) {
+	w.enqueue(spoolEntry{Build: &result})
+}
+
+func (w *resultWriter) enqueue(entry spoolEntry) {
+	w.queue <- entry
+}
+
+// Wait until all enqueued results are written or spooled.
+// The writer must not be used after this call.
+func (w *resultWriter) close() {
+	close(w.queue)
+	w.wg.Wait()
+	if w.num_spool > 0 {
+		w.logger.Warnf("%d results are spooled to %s, and will be recorded in the next test cycle.", w.num_spool, w.spool_file)
+	}
+}
+
+// Append an entry to the spool file.
+func append_spool(spool_file string, entry spoolEntry) error {
+	f, err := os.OpenFile(spool_file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(entry); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Write results in the spool file to the result store.
+// Entries which still cannot be written are kept in the file.
+// It returns the number of entries written.
+func flush_spool(logger *zap.SugaredLogger, store ResultStore, spool_file string) (int, error) {
+	if spool_file == "" {
+		spool_file = DefaultSpoolFile
+	}
+	f, err := os.Open(spool_file)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	remaining := make([]spoolEntry, 0)
+	written := 0
+	scanner := bufio.NewScanner(f)
+	// stdout and stderr of a result can be large
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var entry spoolEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			logger.Warnw("Skipping broken spool entry", "error", err)
+			continue
+		}
+		// keep the order of results once the result store fails
+		if len(remaining) == 0 {
+			if err := entry.write(store); err == nil {
+				written++
+				continue
+			}
+		}
+		remaining = append(remaining, entry)
+	}
+	f.Close()
+	if err := scanner.Err(); err != nil {
+		return written, err
+	}
+
+	if len(remaining) == 0 {
+		return written, os.Remove(spool_file)
+	}
+
+	// replace the spool file atomically, so that a crash never loses entries
+	tmp, err := os.CreateTemp(filepath.Dir(spool_file), filepath.Base(spool_file)+".*")
+	if err != nil {
+		return written, err
+	}
+	encoder := json.NewEncoder(tmp)
+	for _, entry := range remaining {
+		if err := encoder.Encode(entry); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return written, err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return written, err
+	}
+	if err := os.Rename(tmp.Name(), spool_file); err != nil {
+		os.Remove(tmp.Name())
+		return written, err
+	}
+	logger.Warnf("%d results remain in %s.", len(remaining), spool_file)
+	return written, nil
+}
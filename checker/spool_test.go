@@ -0,0 +1,203 @@
+package checker
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Fake result store which fails the first `failures` writes.
+type flakyStore struct {
+	mu       sync.Mutex
+	failures int
+	results  []DbResult
+	builds   []DbBuildResult
+}
+
+func (s *flakyStore) fail() bool {
+	if s.failures != 0 {
+		s.failures--
+		return true
+	}
+	return false
+}
+
+func (s *flakyStore) RecordResult(chall Challenge, result TestResultMessage, run_id string, attempt uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail() {
+		return errors.New("connection refused")
+	}
+	s.results = append(s.results, chall.intoDbResult(result, run_id, attempt))
+	return nil
+}
+
+func (s *flakyStore) RecordBuildResult(result DbBuildResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail() {
+		return errors.New("connection refused")
+	}
+	s.builds = append(s.builds, result)
+	return nil
+}
+
+func (s *flakyStore) FetchResult(chall_name string, limit int) ([]DbResult, error) {
+	return nil, nil
+}
+
+func (s *flakyStore) FetchResultPage(chall_name string, offset int, limit int) ([]DbResult, error) {
+	return nil, nil
+}
+
+func (s *flakyStore) FetchResultRange(chall_name string, from time.Time, to time.Time) ([]DbResult, error) {
+	return nil, nil
+}
+
+func (s *flakyStore) FetchLatestResults() ([]DbResult, error) {
+	return nil, nil
+}
+
+func (s *flakyStore) FetchLastResultIn(chall_name string, results []TestResult) (DbResult, error) {
+	return DbResult{}, sql.ErrNoRows
+}
+
+func (s *flakyStore) FetchLog(chall_name string, run_id string, attempt uint) (DbLog, error) {
+	return DbLog{}, nil
+}
+
+func (s *flakyStore) FetchBuildResult(chall_name string, limit int) ([]DbBuildResult, error) {
+	return nil, nil
+}
+
+func (s *flakyStore) RecordMaintenanceWindow(window MaintenanceWindow) (int64, error) {
+	return 0, nil
+}
+
+func (s *flakyStore) FetchMaintenanceWindows(at time.Time) ([]MaintenanceWindow, error) {
+	return nil, nil
+}
+
+func (s *flakyStore) DeleteMaintenanceWindow(id int64) error {
+	return nil
+}
+
+func (s *flakyStore) RecordSlackThread(thread DbSlackThread) error {
+	return nil
+}
+
+func (s *flakyStore) FetchSlackThread(channel string, chall_name string) (DbSlackThread, error) {
+	return DbSlackThread{}, sql.ErrNoRows
+}
+
+func (s *flakyStore) DeleteSlackThread(channel string, chall_name string) error {
+	return nil
+}
+
+func (s *flakyStore) Migrate(logger *zap.SugaredLogger) error { return nil }
+func (s *flakyStore) VerifySchema() error                     { return nil }
+func (s *flakyStore) Close() error                            { return nil }
+
+func TestSpool_RetryWrite(t *testing.T) {
+	spool_file := filepath.Join(t.TempDir(), "spool.jsonl")
+	store := &flakyStore{failures: writeAttempts - 1}
+	writer := new_result_writer(create_logger(), store, spool_file, 1)
+	writer.backoff = time.Millisecond
+
+	writer.record_result(Challenge{Name: "test"}, TestResultMessage{Result: ResultSuccess}, "run", 1)
+	writer.close()
+
+	if len(store.results) != 1 {
+		t.Errorf("Expected the result written after retries, got %d results", len(store.results))
+	}
+	if _, err := os.Stat(spool_file); !os.IsNotExist(err) {
+		t.Errorf("Nothing must be spooled")
+	}
+}
+
+func TestSpool_SpoolAndFlush(t *testing.T) {
+	logger := create_logger()
+	spool_file := filepath.Join(t.TempDir(), "spool.jsonl")
+	store := &flakyStore{failures: -1}
+	writer := new_result_writer(logger, store, spool_file, 4)
+	writer.backoff = time.Millisecond
+
+	// results are spooled while the store is down
+	timestamp := time.Date(2023, 11, 4, 1, 2, 3, 0, time.UTC)
+	for i := 1; i <= 3; i++ {
+		writer.record_result(Challenge{Name: "test"}, TestResultMessage{Result: ResultFailure, Stdout: "NG", Timestamp: timestamp}, "run", uint(i))
+	}
+	writer.record_build(DbBuildResult{Name: "test", Result: ResultSuccess, Timestamp: timestamp})
+	writer.close()
+
+	if len(store.results) != 0 || len(store.builds) != 0 {
+		t.Fatalf("Nothing must be written while the store is down")
+	}
+
+	// nothing is written until the store recovers
+	if written, err := flush_spool(logger, store, spool_file); err != nil || written != 0 {
+		t.Fatalf("flush_spool() = %d, %v, want 0, nil", written, err)
+	}
+
+	// spooled results are written in order with the original timestamps
+	store.failures = 0
+	written, err := flush_spool(logger, store, spool_file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != 4 || len(store.results) != 3 || len(store.builds) != 1 {
+		t.Fatalf("Expected 3 results and 1 build written, got %d results and %d builds", len(store.results), len(store.builds))
+	}
+	for i, result := range store.results {
+		if result.Attempt != uint(i+1) || result.Result != ResultFailure || !result.Timestamp.Equal(timestamp) {
+			t.Errorf("Unexpected result: %+v", result)
+		}
+	}
+	if _, err := os.Stat(spool_file); !os.IsNotExist(err) {
+		t.Errorf("Spool file must be removed after flush")
+	}
+}
+
+func TestSpool_PartialFlush(t *testing.T) {
+	logger := create_logger()
+	spool_file := filepath.Join(t.TempDir(), "spool.jsonl")
+	for i := 1; i <= 3; i++ {
+		entry := spoolEntry{Test: &spoolTestResult{Name: "test", Result: TestResultMessage{Result: ResultSuccess}, RunID: "run", Attempt: uint(i)}}
+		if err := append_spool(spool_file, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the store goes down after the first write
+	store := &flakyStore{}
+	first := &flakyStore{}
+	if written, err := flush_spool(logger, &onceStore{first}, spool_file); err != nil || written != 1 {
+		t.Fatalf("flush_spool() = %d, %v, want 1, nil", written, err)
+	}
+
+	written, err := flush_spool(logger, store, spool_file)
+	if err != nil || written != 2 {
+		t.Fatalf("flush_spool() = %d, %v, want 2, nil", written, err)
+	}
+	if first.results[0].Attempt != 1 || store.results[0].Attempt != 2 || store.results[1].Attempt != 3 {
+		t.Errorf("Results must be written in order")
+	}
+}
+
+// Result store which accepts only the first write.
+type onceStore struct {
+	*flakyStore
+}
+
+func (s *onceStore) RecordResult(chall Challenge, result TestResultMessage, run_id string, attempt uint) error {
+	if len(s.results) > 0 {
+		return errors.New("connection refused")
+	}
+	return s.flakyStore.RecordResult(chall, result, run_id, attempt)
+}
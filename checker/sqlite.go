@@ -0,0 +1,165 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+)
+
+// Pragmas applied to every connection unless the DSN sets them.
+// Locks held by other processes (eg: badge server) are waited for instead of failing immediately.
+var sqlitePragmas = []string{"busy_timeout(10000)", "journal_mode(WAL)"}
+
+// Build a DSN of a bare path or a `file:` URI, adding sqlitePragmas to its query.
+func sqlite_dsn(path string) (string, error) {
+	if !strings.HasPrefix(path, "file:") {
+		path = "file:" + path
+	}
+	base, query, _ := strings.Cut(path, "?")
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return "", fmt.Errorf("Invalid query of SQLite DSN: %v", err)
+	}
+
+	params := make([]string, 0, len(sqlitePragmas)+1)
+	if query != "" {
+		params = append(params, query)
+	}
+	for _, pragma := range sqlitePragmas {
+		name, _, _ := strings.Cut(pragma, "(")
+		overridden := false
+		for _, value := range values["_pragma"] {
+			if strings.HasPrefix(strings.ToLower(strings.TrimSpace(value)), name) {
+				overridden = true
+			}
+		}
+		if !overridden {
+			params = append(params, "_pragma="+pragma)
+		}
+	}
+	return base + "?" + strings.Join(params, "&"), nil
+}
+
+// Open a SQLite database file, creating it if it does not exist.
+// Either a bare path or a `file:` URI with query parameters is accepted.
+// No database server is required.
+func ConnectSQLite(path string) (*sqlx.DB, error) {
+	dsn, err := sqlite_dsn(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sqlx.Connect("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows only one writer at a time
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// Add a column unless it already exists.
+func sqlite_add_column(ctx context.Context, conn *sqlx.Conn, table string, column string, definition string) error {
+	var count int
+	query := `select count(*) from pragma_table_info(?) where name = ?`
+	if err := conn.GetContext(ctx, &count, query, table, column); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return exec_all(ctx, conn, fmt.Sprintf("alter table %s add column %s %s", table, column, definition))
+}
+
+var sqliteDialect = dialect{
+	version_table_query: `select count(*) from sqlite_master where type = 'table' and name = 'schema_version'`,
+	timestamp_type:      "datetime",
+	// a single connection is used by a process, and writes of other processes wait on busy_timeout
+	lock: func(ctx context.Context, conn *sqlx.Conn) (func(), error) {
+		return func() {}, nil
+	},
+	migrations: []migration{
+		{
+			version:     1,
+			description: "create tables",
+			// `result` is a value of `TestResult` in executer.go
+			apply: func(ctx context.Context, conn *sqlx.Conn) error {
+				return exec_all(ctx, conn,
+					"create table if not exists test_result ("+
+						"id integer primary key autoincrement, "+
+						"name varchar(255) not null, "+
+						"result int not null, "+
+						"timestamp datetime not null, "+
+						"attempt int not null default 1, "+
+						"run_id varchar(32) not null default '', "+
+						"build_duration double not null default 0, "+
+						"run_duration double not null default 0, "+
+						"exit_code int not null default -1"+
+						")",
+					"create index if not exists idx_test_result_name_timestamp on test_result (name, timestamp)",
+					"create table if not exists test_log ("+
+						"id integer primary key autoincrement, "+
+						"run_id varchar(32) not null, "+
+						"name varchar(255) not null, "+
+						"attempt int not null, "+
+						"stdout text not null, "+
+						"stderr text not null, "+
+						"timestamp datetime not null"+
+						")",
+					"create index if not exists idx_test_log_name_run_id_attempt on test_log (name, run_id, attempt)",
+					"create table if not exists build_result ("+
+						"id integer primary key autoincrement, "+
+						"name varchar(255) not null, "+
+						"result int not null, "+
+						"solver_hash varchar(64) not null, "+
+						"cached boolean not null, "+
+						"timestamp datetime not null"+
+						")",
+					"create index if not exists idx_build_result_name_timestamp on build_result (name, timestamp)",
+				)
+			},
+		},
+		{
+			version:     2,
+			description: "add genre to test_result",
+			apply: func(ctx context.Context, conn *sqlx.Conn) error {
+				return sqlite_add_column(ctx, conn, "test_result", "genre", "varchar(255) not null default ''")
+			},
+		},
+		{
+			version:     3,
+			description: "create maintenance_window",
+			apply: func(ctx context.Context, conn *sqlx.Conn) error {
+				return exec_all(ctx, conn,
+					"create table if not exists maintenance_window ("+
+						"id integer primary key autoincrement, "+
+						"challenge varchar(255) not null default '', "+
+						"genre varchar(255) not null default '', "+
+						"start_at datetime not null, "+
+						"end_at datetime not null, "+
+						"reason varchar(1024) not null default ''"+
+						")",
+					"create index if not exists idx_maintenance_window_end_at on maintenance_window (end_at)",
+				)
+			},
+		},
+		{
+			version:     4,
+			description: "create slack_thread",
+			apply: func(ctx context.Context, conn *sqlx.Conn) error {
+				return exec_all(ctx, conn,
+					"create table if not exists slack_thread ("+
+						"channel varchar(255) not null, "+
+						"challenge varchar(255) not null, "+
+						"channel_id varchar(255) not null, "+
+						"ts varchar(64) not null, "+
+						"primary key (channel, challenge)"+
+						")",
+				)
+			},
+		},
+	},
+}
@@ -0,0 +1,57 @@
+package checker
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLite_DSN(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"bare-path", "checker.db", "file:checker.db?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)"},
+		{"uri", "file:checker.db", "file:checker.db?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)"},
+		{"uri-with-query", "file:checker.db?mode=rwc", "file:checker.db?mode=rwc&_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)"},
+		{"overridden-pragma", "file:checker.db?_pragma=journal_mode(DELETE)", "file:checker.db?_pragma=journal_mode(DELETE)&_pragma=busy_timeout(10000)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sqlite_dsn(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("sqlite_dsn() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := sqlite_dsn("file:checker.db?mode=%zz"); err == nil {
+		t.Errorf("Expected error for an invalid query")
+	}
+}
+
+func TestSQLite_ConnectURI(t *testing.T) {
+	db, err := ConnectSQLite("file:" + filepath.Join(t.TempDir(), "checker.db") + "?mode=rwc&_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var timeout int
+	if err := db.Get(&timeout, "pragma busy_timeout"); err != nil {
+		t.Fatal(err)
+	}
+	if timeout != 5000 {
+		t.Errorf("busy_timeout = %d, want 5000", timeout)
+	}
+	var mode string
+	if err := db.Get(&mode, "pragma journal_mode"); err != nil {
+		t.Fatal(err)
+	}
+	if mode != "wal" {
+		t.Errorf("journal_mode = %q, want wal", mode)
+	}
+}
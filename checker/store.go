@@ -0,0 +1,365 @@
+package checker
+
+// This file implements the storage of test results on SQL databases.
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// Storage of test results used by the checker and the badge server.
+type ResultStore interface {
+	// Write and commit test result and its stdout/stderr.
+	// `run_id` is ID of the test cycle, and `attempt` is 1-origin attempt number of the test in the cycle.
+	// If the timestamp of the result is zero, the current time is recorded.
+	RecordResult(chall Challenge, result TestResultMessage, run_id string, attempt uint) error
+	// Query latest test results of a challenge, newest first.
+	FetchResult(chall_name string, limit int) ([]DbResult, error)
+	// Query test results of a challenge, newest first, skipping the latest `offset` results.
+	FetchResultPage(chall_name string, offset int, limit int) ([]DbResult, error)
+	// Query test results of a challenge recorded in [from, to], oldest first.
+	FetchResultRange(chall_name string, from time.Time, to time.Time) ([]DbResult, error)
+	// Query the latest test result of every challenge recorded, ordered by name.
+	FetchLatestResults() ([]DbResult, error)
+	// Query the latest test result of a challenge which is one of `results`.
+	// sql.ErrNoRows is returned if there is no such result.
+	FetchLastResultIn(chall_name string, results []TestResult) (DbResult, error)
+	// Query stdout/stderr of a test run by challenge ID, ID of the test cycle and attempt number.
+	FetchLog(chall_name string, run_id string, attempt uint) (DbLog, error)
+	// Write and commit result of a prebuild.
+	// If the timestamp is zero, the current time is recorded.
+	RecordBuildResult(result DbBuildResult) error
+	// Query latest build results of a challenge, newest first.
+	FetchBuildResult(chall_name string, limit int) ([]DbBuildResult, error)
+	// Write a maintenance window and return its ID.
+	RecordMaintenanceWindow(window MaintenanceWindow) (int64, error)
+	// Query maintenance windows which end after `at`, ordered by their start.
+	FetchMaintenanceWindows(at time.Time) ([]MaintenanceWindow, error)
+	// Delete a maintenance window by ID. sql.ErrNoRows is returned if there is no such window.
+	DeleteMaintenanceWindow(id int64) error
+	// Write the Slack thread of the open alert of a challenge, replacing the previous one.
+	RecordSlackThread(thread DbSlackThread) error
+	// Query the Slack thread of the open alert of a challenge. sql.ErrNoRows is returned if there is no such thread.
+	FetchSlackThread(channel string, chall_name string) (DbSlackThread, error)
+	// Delete the Slack thread of a challenge whose alert is closed.
+	DeleteSlackThread(channel string, chall_name string) error
+	// Apply pending migrations of the schema.
+	Migrate(logger *zap.SugaredLogger) error
+	// Check if the schema is up to date.
+	VerifySchema() error
+	Close() error
+}
+
+// Schema of test result table.
+type DbResult struct {
+	Name      string     `db:"name"`
+	Genre     string     `db:"genre"`
+	Result    TestResult `db:"result"`
+	Timestamp time.Time  `db:"timestamp"`
+	Attempt   uint       `db:"attempt"`
+	RunID     string     `db:"run_id"`
+	// seconds taken to build the solver image. 0 if the cached image is used.
+	BuildDuration float64 `db:"build_duration"`
+	// seconds taken to run the solver
+	RunDuration float64 `db:"run_duration"`
+	// exit code of the solver. -1 if the solver did not finish.
+	ExitCode int `db:"exit_code"`
+}
+
+// Schema of test log table.
+type DbLog struct {
+	RunID     string    `db:"run_id"`
+	Name      string    `db:"name"`
+	Attempt   uint      `db:"attempt"`
+	Stdout    string    `db:"stdout"`
+	Stderr    string    `db:"stderr"`
+	Timestamp time.Time `db:"timestamp"`
+}
+
+// Schema of build result table.
+type DbBuildResult struct {
+	Name       string     `db:"name"`
+	Result     TestResult `db:"result"`
+	SolverHash string     `db:"solver_hash"`
+	Cached     bool       `db:"cached"` // the image built from the same solver is reused
+	Timestamp  time.Time  `db:"timestamp"`
+}
+
+// Schema of Slack thread table. Follow-ups of an alert are threaded under the message `ts` in `channel_id`.
+type DbSlackThread struct {
+	Channel   string `db:"channel"` // channel configured for the notifier
+	Challenge string `db:"challenge"`
+	ChannelID string `db:"channel_id"`
+	TS        string `db:"ts"`
+}
+
+// Converter of `Challenge` into `DBResult`.
+func (chall *Challenge) intoDbResult(result TestResultMessage, run_id string, attempt uint) DbResult {
+	return DbResult{
+		Name:          chall.Name,
+		Genre:         chall.Genre,
+		Result:        result.Result,
+		Attempt:       attempt,
+		RunID:         run_id,
+		BuildDuration: result.BuildTime.Seconds(),
+		RunDuration:   result.RunTime.Seconds(),
+		ExitCode:      result.ExitCode,
+		Timestamp:     result.Timestamp,
+	}
+}
+
+// Normalize a timestamp written to or compared in the database.
+// SQLite stores timestamps as text, so they must be in the same zone and have no monotonic clock reading
+// to be compared correctly.
+func db_time(t time.Time) time.Time {
+	return t.UTC()
+}
+
+// Open a result store on the database specified by params.
+func OpenStore(params DbParams) (*SQLStore, error) {
+	var db *sqlx.DB
+	var err error
+	switch params.Driver {
+	case "", "mysql":
+		db, err = Connect(params)
+	case "sqlite":
+		path := params.Path
+		if params.DSN != "" {
+			path = params.DSN
+		}
+		db, err = ConnectSQLite(path)
+	case "postgres":
+		db, err = ConnectPostgres(params)
+	default:
+		return nil, fmt.Errorf("Unknown database driver: %s", params.Driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSQLStore(db)
+}
+
+// Result store on MySQL, SQLite or PostgreSQL.
+// Queries are written in the common subset of their SQL dialects,
+// and only the schema migrations differ among them.
+type SQLStore struct {
+	db      *sqlx.DB
+	dialect *dialect
+}
+
+// Create a result store on a connected database.
+// The dialect is chosen by the driver name of db.
+func NewSQLStore(db *sqlx.DB) (*SQLStore, error) {
+	var d *dialect
+	switch db.DriverName() {
+	case "mysql":
+		d = &mysqlDialect
+	case "sqlite":
+		d = &sqliteDialect
+	case "postgres":
+		d = &postgresDialect
+	default:
+		return nil, fmt.Errorf("Unsupported database driver: %s", db.DriverName())
+	}
+	return &SQLStore{db: db, dialect: d}, nil
+}
+
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLStore) RecordResult(chall Challenge, result TestResultMessage, run_id string, attempt uint) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	dbresult := chall.intoDbResult(result, run_id, attempt)
+	if dbresult.Timestamp.IsZero() {
+		dbresult.Timestamp = time.Now()
+	}
+	dbresult.Timestamp = db_time(dbresult.Timestamp)
+	query := "insert into test_result(name, genre, result, timestamp, attempt, run_id, build_duration, run_duration, exit_code) values(:name, :genre, :result, :timestamp, :attempt, :run_id, :build_duration, :run_duration, :exit_code)"
+	if _, err := tx.NamedExec(query, dbresult); err != nil {
+		return err
+	}
+
+	dblog := DbLog{
+		RunID:     run_id,
+		Name:      chall.Name,
+		Attempt:   attempt,
+		Stdout:    result.Stdout,
+		Stderr:    result.Errlog,
+		Timestamp: dbresult.Timestamp,
+	}
+	query = "insert into test_log(run_id, name, attempt, stdout, stderr, timestamp) values(:run_id, :name, :attempt, :stdout, :stderr, :timestamp)"
+	if _, err := tx.NamedExec(query, dblog); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLStore) FetchResult(chall_name string, limit int) ([]DbResult, error) {
+	return s.FetchResultPage(chall_name, 0, limit)
+}
+
+func (s *SQLStore) FetchResultPage(chall_name string, offset int, limit int) ([]DbResult, error) {
+	results := make([]DbResult, 0)
+
+	query := s.db.Rebind(`select name, genre, result, timestamp, attempt, run_id, build_duration, run_duration, exit_code from test_result where name = ? order by timestamp desc, id desc limit ? offset ?`)
+	if err := s.db.Select(&results, query, chall_name, limit, offset); err != nil {
+		return results, err
+	}
+	return results, nil
+}
+
+func (s *SQLStore) FetchResultRange(chall_name string, from time.Time, to time.Time) ([]DbResult, error) {
+	results := make([]DbResult, 0)
+
+	query := s.db.Rebind(`select name, genre, result, timestamp, attempt, run_id, build_duration, run_duration, exit_code from test_result where name = ? and timestamp >= ? and timestamp <= ? order by timestamp, id`)
+	if err := s.db.Select(&results, query, chall_name, db_time(from), db_time(to)); err != nil {
+		return results, err
+	}
+	return results, nil
+}
+
+func (s *SQLStore) FetchLatestResults() ([]DbResult, error) {
+	results := make([]DbResult, 0)
+
+	// results recorded at the same time are ordered by id
+	query := `select name, genre, result, timestamp, attempt, run_id, build_duration, run_duration, exit_code from test_result t ` +
+		`where id = (select id from test_result where name = t.name order by timestamp desc, id desc limit 1) order by name`
+	if err := s.db.Select(&results, query); err != nil {
+		return results, err
+	}
+	return results, nil
+}
+
+func (s *SQLStore) FetchLastResultIn(chall_name string, results []TestResult) (DbResult, error) {
+	var result DbResult
+
+	query, args, err := sqlx.In(`select name, genre, result, timestamp, attempt, run_id, build_duration, run_duration, exit_code from test_result where name = ? and result in (?) order by timestamp desc, id desc limit 1`, chall_name, results)
+	if err != nil {
+		return result, err
+	}
+	if err := s.db.Get(&result, s.db.Rebind(query), args...); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+func (s *SQLStore) FetchLog(chall_name string, run_id string, attempt uint) (DbLog, error) {
+	var log DbLog
+
+	query := s.db.Rebind(`select run_id, name, attempt, stdout, stderr, timestamp from test_log where name = ? and run_id = ? and attempt = ?`)
+	if err := s.db.Get(&log, query, chall_name, run_id, attempt); err != nil {
+		return log, err
+	}
+	return log, nil
+}
+
+func (s *SQLStore) RecordBuildResult(result DbBuildResult) error {
+	if result.Timestamp.IsZero() {
+		result.Timestamp = time.Now()
+	}
+	result.Timestamp = db_time(result.Timestamp)
+	query := "insert into build_result(name, result, solver_hash, cached, timestamp) values(:name, :result, :solver_hash, :cached, :timestamp)"
+	_, err := s.db.NamedExec(query, result)
+	return err
+}
+
+func (s *SQLStore) FetchBuildResult(chall_name string, limit int) ([]DbBuildResult, error) {
+	results := make([]DbBuildResult, 0)
+
+	query := s.db.Rebind(`select name, result, solver_hash, cached, timestamp from build_result where name = ? order by timestamp desc limit ?`)
+	if err := s.db.Select(&results, query, chall_name, limit); err != nil {
+		return results, err
+	}
+	return results, nil
+}
+
+func (s *SQLStore) RecordMaintenanceWindow(window MaintenanceWindow) (int64, error) {
+	window.Start = db_time(window.Start)
+	window.End = db_time(window.End)
+	query := "insert into maintenance_window(challenge, genre, start_at, end_at, reason) values(:challenge, :genre, :start_at, :end_at, :reason)"
+	// PostgreSQL does not support LastInsertId
+	if s.db.DriverName() == "postgres" {
+		rows, err := s.db.NamedQuery(query+" returning id", window)
+		if err != nil {
+			return 0, err
+		}
+		defer rows.Close()
+		var id int64
+		if rows.Next() {
+			err = rows.Scan(&id)
+		}
+		return id, err
+	}
+
+	result, err := s.db.NamedExec(query, window)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (s *SQLStore) FetchMaintenanceWindows(at time.Time) ([]MaintenanceWindow, error) {
+	windows := make([]MaintenanceWindow, 0)
+
+	query := s.db.Rebind(`select id, challenge, genre, start_at, end_at, reason from maintenance_window where end_at > ? order by start_at, id`)
+	if err := s.db.Select(&windows, query, db_time(at)); err != nil {
+		return windows, err
+	}
+	return windows, nil
+}
+
+func (s *SQLStore) DeleteMaintenanceWindow(id int64) error {
+	result, err := s.db.Exec(s.db.Rebind(`delete from maintenance_window where id = ?`), id)
+	if err != nil {
+		return err
+	}
+	if deleted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if deleted == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *SQLStore) RecordSlackThread(thread DbSlackThread) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// upserts differ among the dialects
+	if _, err := tx.Exec(tx.Rebind(`delete from slack_thread where channel = ? and challenge = ?`), thread.Channel, thread.Challenge); err != nil {
+		return err
+	}
+	query := "insert into slack_thread(channel, challenge, channel_id, ts) values(:channel, :challenge, :channel_id, :ts)"
+	if _, err := tx.NamedExec(query, thread); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) FetchSlackThread(channel string, chall_name string) (DbSlackThread, error) {
+	var thread DbSlackThread
+
+	query := s.db.Rebind(`select channel, challenge, channel_id, ts from slack_thread where channel = ? and challenge = ?`)
+	if err := s.db.Get(&thread, query, channel, chall_name); err != nil {
+		return thread, err
+	}
+	return thread, nil
+}
+
+func (s *SQLStore) DeleteSlackThread(channel string, chall_name string) error {
+	_, err := s.db.Exec(s.db.Rebind(`delete from slack_thread where channel = ? and challenge = ?`), channel, chall_name)
+	return err
+}
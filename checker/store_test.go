@@ -0,0 +1,184 @@
+package checker
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func count_records(store *SQLStore) (int, error) {
+	var count int
+	if err := store.db.Get(&count, "select count(*) from test_result"); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Check operations of a result store whose schema is up to date.
+func test_store_operations(t *testing.T, store *SQLStore) {
+	t.Helper()
+
+	// record results
+	chall := Challenge{
+		Name:    "test",
+		Timeout: 5,
+	}
+	run_id := new_run_id()
+	for i := 0; i < 3; i++ {
+		res := TestResultMessage{Result: ResultSuccess, Stdout: fmt.Sprintf("stdout %d", i+1), Errlog: "stderr", RunTime: 1500 * time.Millisecond}
+		if err := store.RecordResult(chall, res, run_id, uint(i+1)); err != nil {
+			t.Fatal(err)
+		}
+		// timestamps must differ to be ordered
+		time.Sleep(1100 * time.Millisecond)
+	}
+
+	count, err := count_records(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("count = %d, want 3", count)
+	}
+
+	// fetch results
+	results, err := store.FetchResult(chall.Name, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("len(results) = %d, want 2", len(results))
+	}
+	if results[0].Result != ResultSuccess {
+		t.Errorf("results[0].Result = %v, want %v", results[0].Result, ResultSuccess)
+	}
+	if results[0].Name != chall.Name {
+		t.Errorf("results[0].Name = %v, want %v", results[0].Name, chall.Name)
+	}
+	if results[0].Attempt != 3 {
+		t.Errorf("results[0].Attempt = %v, want 3", results[0].Attempt)
+	}
+	if results[0].RunID != run_id {
+		t.Errorf("results[0].RunID = %v, want %v", results[0].RunID, run_id)
+	}
+	if results[0].RunDuration != 1.5 || results[0].ExitCode != 0 {
+		t.Errorf("results[0] = %+v, want run_duration 1.5 and exit_code 0", results[0])
+	}
+
+	// fetch results by page
+	page, err := store.FetchResultPage(chall.Name, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 || page[0].Attempt != 1 {
+		t.Errorf("page = %+v, want only attempt 1", page)
+	}
+
+	// fetch results in a range
+	ranged, err := store.FetchResultRange(chall.Name, page[0].Timestamp, results[1].Timestamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ranged) != 2 || ranged[0].Attempt != 1 || ranged[1].Attempt != 2 {
+		t.Errorf("ranged = %+v, want attempts 1 and 2", ranged)
+	}
+
+	// fetch latest results of all challenges
+	other := Challenge{Name: "another", Genre: "pwn"}
+	if err := store.RecordResult(other, TestResultMessage{Result: ResultFailure, ExitCode: 1}, run_id, 1); err != nil {
+		t.Fatal(err)
+	}
+	latest, err := store.FetchLatestResults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(latest) != 2 || latest[0].Name != other.Name || latest[1].Name != chall.Name || latest[1].Attempt != 3 {
+		t.Errorf("latest = %+v, want the latest results of %s and %s", latest, other.Name, chall.Name)
+	}
+
+	// fetch the last result of given kinds
+	last, err := store.FetchLastResultIn(other.Name, []TestResult{ResultFailure, ResultTimeout})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.Result != ResultFailure || last.Genre != other.Genre {
+		t.Errorf("last = %+v, want the failure of %s", last, other.Name)
+	}
+	if _, err := store.FetchLastResultIn(other.Name, []TestResult{ResultSuccess}); err != sql.ErrNoRows {
+		t.Errorf("FetchLastResultIn() error = %v, want %v", err, sql.ErrNoRows)
+	}
+
+	// fetch log
+	log, err := store.FetchLog(chall.Name, run_id, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log.Stdout != "stdout 2" || log.Stderr != "stderr" {
+		t.Errorf("log = %+v, want stdout %q and stderr %q", log, "stdout 2", "stderr")
+	}
+
+	// build results
+	if err := store.RecordBuildResult(DbBuildResult{Name: chall.Name, Result: ResultBuildFailure, SolverHash: "0123456789abcdef", Cached: true}); err != nil {
+		t.Fatal(err)
+	}
+	builds, err := store.FetchBuildResult(chall.Name, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(builds) != 1 || builds[0].Result != ResultBuildFailure || builds[0].SolverHash != "0123456789abcdef" || !builds[0].Cached {
+		t.Errorf("builds = %+v, want a cached build failure", builds)
+	}
+
+	// slack threads are replaced and deleted per channel and challenge
+	for _, ts := range []string{"1700000000.000100", "1700000000.000200"} {
+		if err := store.RecordSlackThread(DbSlackThread{Channel: "#status", Challenge: chall.Name, ChannelID: "C0123", TS: ts}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	thread, err := store.FetchSlackThread("#status", chall.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thread.ChannelID != "C0123" || thread.TS != "1700000000.000200" {
+		t.Errorf("thread = %+v, want the latest one", thread)
+	}
+	if _, err := store.FetchSlackThread("#other", chall.Name); err != sql.ErrNoRows {
+		t.Errorf("FetchSlackThread() error = %v, want %v", err, sql.ErrNoRows)
+	}
+	if err := store.DeleteSlackThread("#status", chall.Name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.FetchSlackThread("#status", chall.Name); err != sql.ErrNoRows {
+		t.Errorf("FetchSlackThread() after deletion error = %v, want %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestStore_SQLite(t *testing.T) {
+	db, err := ConnectSQLite(filepath.Join(t.TempDir(), "checker.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewSQLStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := store.VerifySchema(); err == nil {
+		t.Errorf("VerifySchema() must fail before migrations")
+	}
+	if err := store.Migrate(create_logger()); err != nil {
+		t.Fatal(err)
+	}
+	// migrations are idempotent
+	if err := store.Migrate(create_logger()); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.VerifySchema(); err != nil {
+		t.Fatal(err)
+	}
+
+	test_store_operations(t, store)
+}
@@ -0,0 +1,187 @@
+package checker
+
+// This file implements notifiers posting to Discord and generic HTTP webhooks.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// Maximum length of a message of Discord.
+const discordMessageLimit = 2000
+
+// Body of webhooks used when no template is configured.
+const defaultWebhookTemplate = `{` +
+	`"kind": {{json .Kind}}, ` +
+	`"challenge": {{json .Chall.Name}}, ` +
+	`"genre": {{json .Chall.Genre}}, ` +
+	`"assignee": {{json .Chall.Assignee}}, ` +
+	`"result": {{json .Result.ToStatus}}, ` +
+	`"message": {{json .Result.ToMessage}}, ` +
+	`"run_id": {{json .RunID}}, ` +
+	`"attempt": {{json .Attempt}}, ` +
+	`"timestamp": {{json .Timestamp}}, ` +
+	`"failures": {{json .Failures}}, ` +
+	`"broken_since": {{json .BrokenSince}}, ` +
+	`"affected": {{json .Affected}}, ` +
+	`"stdout": {{json .Stdout}}, ` +
+	`"stderr": {{json .Errlog}}` +
+	`}`
+
+// Functions available in templates of webhook bodies.
+var webhookFuncs = template.FuncMap{
+	// encode a value as JSON, eg: {{json .Chall.Name}}
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	// cut a string to at most n bytes without splitting a character, eg: {{truncate 1000 .Stdout}}
+	"truncate": func(n int, s string) string {
+		return cut_head(s, n)
+	},
+}
+
+// Send a request and check its status code.
+func send_request(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s responded %d: %s", req.Method, req.URL.Redacted(), resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// Notifier posting to a Discord webhook.
+type DiscordNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewDiscordNotifier(url string) *DiscordNotifier {
+	return &DiscordNotifier{url: url, client: new_http_client()}
+}
+
+func (d *DiscordNotifier) Notify(n Notification) error {
+	body, err := json.Marshal(map[string]any{
+		"username": "TSGCTF Status",
+		"content":  discord_message(n),
+		// outputs of solvers must not ping anyone
+		"allowed_mentions": map[string]any{"parse": []string{}},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return send_request(d.client, req)
+}
+
+// Message of a notification posted to Discord.
+// Outputs are truncated inside their code blocks so that the message fits in the limit with its fences kept.
+func discord_message(n Notification) string {
+	if n.Kind == NotifyRecovery {
+		return recovery_message(n)
+	}
+	message := func(stdout string, errlog string) string {
+		if n.Chall.Name == "" {
+			return fmt.Sprintf("%s\nErrors:\n```\n%s\n```\n", alert_summary(n), errlog)
+		}
+		// Slack user IDs cannot be mentioned in Discord, so the assignee is shown as plain text
+		return notification_message(n.Chall, n.Result, stdout, errlog, n.Chall.Assignee)
+	}
+
+	stdout, errlog := n.Stdout, n.Errlog
+	// only stderr is shown for build failures and the health of the checker
+	if n.Chall.Name == "" || n.Result == ResultBuildFailure {
+		stdout = ""
+	}
+	over := len(message(stdout, errlog)) - discordMessageLimit
+	if over <= 0 {
+		return message(stdout, errlog)
+	}
+
+	// share the rest of the limit between the outputs, giving what a short one does not use to the other
+	budget := max(len(stdout)+len(errlog)-over, 0)
+	stdout_budget := min(budget/2, len(stdout))
+	errlog_budget := min(budget-stdout_budget, len(errlog))
+	stdout_budget = budget - errlog_budget
+	return message(cut_output(stdout, stdout_budget), cut_output(errlog, errlog_budget))
+}
+
+// Truncate an output to at most `max_size` bytes, which may be zero.
+func cut_output(output string, max_size int) string {
+	if max_size <= 0 {
+		return ""
+	}
+	return truncate_output(output, max_size)
+}
+
+// Notifier sending a request whose body is rendered from a template.
+type WebhookNotifier struct {
+	url          string
+	method       string
+	headers      map[string]string
+	content_type string
+	body         *template.Template
+	client       *http.Client
+}
+
+func NewWebhookNotifier(conf NotifierConfig) (*WebhookNotifier, error) {
+	if conf.URL == "" {
+		return nil, fmt.Errorf("Webhook notifier requires url")
+	}
+	text := conf.Template
+	if text == "" {
+		text = defaultWebhookTemplate
+	}
+	body, err := template.New("webhook").Funcs(webhookFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse template of webhook: %v", err)
+	}
+
+	w := &WebhookNotifier{
+		url:          conf.URL,
+		method:       conf.Method,
+		headers:      conf.Headers,
+		content_type: conf.ContentType,
+		body:         body,
+		client:       new_http_client(),
+	}
+	if w.method == "" {
+		w.method = http.MethodPost
+	}
+	if w.content_type == "" {
+		w.content_type = "application/json"
+	}
+	return w, nil
+}
+
+func (w *WebhookNotifier) Notify(n Notification) error {
+	var body bytes.Buffer
+	if err := w.body.Execute(&body, n); err != nil {
+		return fmt.Errorf("Failed to render body of webhook: %v", err)
+	}
+
+	req, err := http.NewRequest(w.method, w.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.content_type)
+	for key, value := range w.headers {
+		req.Header.Set(key, value)
+	}
+	return send_request(w.client, req)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tsg-ut/tsgctf-checker/badge"
+	"go.uber.org/zap"
+)
+
+// Respond with the JSON of value, or 304 if the client already has it.
+// ETag is the hash of the JSON, and Last-Modified is the timestamp of the latest result.
+func serve_json(c *gin.Context, value any, last_modified time.Time) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	hash := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(hash[:16]) + `"`
+
+	// clients always revalidate by ETag, since results change at any time
+	c.Header("Cache-Control", "no-cache")
+	c.Header("ETag", etag)
+	if !last_modified.IsZero() {
+		c.Header("Last-Modified", last_modified.UTC().Format(http.TimeFormat))
+	}
+
+	// If-None-Match takes priority over If-Modified-Since (RFC 9110)
+	if inm := c.GetHeader("If-None-Match"); inm != "" {
+		if etag_matches(inm, etag) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	} else if ims := c.GetHeader("If-Modified-Since"); ims != "" && !last_modified.IsZero() {
+		if since, err := http.ParseTime(ims); err == nil && !last_modified.Truncate(time.Second).After(since) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// Check if If-None-Match matches the ETag, eg: `"a", W/"b"`.
+// Entity tags are compared weakly, since proxies may turn them into weak ones (RFC 9110).
+func etag_matches(if_none_match string, etag string) bool {
+	for _, tag := range strings.Split(if_none_match, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse an integer query parameter.
+func query_int(c *gin.Context, key string, default_value int) (int, error) {
+	value := c.Query(key)
+	if value == "" {
+		return default_value, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// Register JSON endpoints of statuses of challenges.
+func register_api(server *gin.Engine, logger *zap.SugaredLogger, badger *badge.Badger) {
+	// latest statuses of all challenges
+	server.GET("/api/challenges", func(c *gin.Context) {
+		list, err := badger.FetchStatusList(time.Now())
+		if err != nil {
+			logger.Warnf("%v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went to bad when fetching test results."})
+			return
+		}
+		serve_json(c, list, list.LastModified())
+	})
+
+	// history of a challenge, newest first
+	server.GET("/api/challenges/:chall_name/history", func(c *gin.Context) {
+		chall_name := c.Params.ByName("chall_name")
+		page, err := query_int(c, "page", 1)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page."})
+			return
+		}
+		per_page, err := query_int(c, "per_page", badge.DefaultPerPage)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid per_page."})
+			return
+		}
+
+		if page < 1 || per_page < 1 || per_page > badge.MaxPerPage {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "page and per_page are out of range."})
+			return
+		}
+
+		history, err := badger.FetchHistory(chall_name, page, per_page)
+		if err != nil {
+			logger.Warnf("%v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went to bad when fetching test results."})
+			return
+		}
+		if page == 1 && len(history.Results) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Challenge not found."})
+			return
+		}
+		serve_json(c, history, history.LastModified())
+	})
+
+	// uptime of a challenge in windows given by ?window= (can be repeated)
+	server.GET("/api/challenges/:chall_name/uptime", func(c *gin.Context) {
+		windows := c.QueryArray("window")
+		if len(windows) == 0 {
+			windows = badge.DefaultWindows
+		}
+		for _, window := range windows {
+			if _, err := badge.ParseWindow(window); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		now := time.Now()
+		uptimes := make([]badge.Uptime, 0, len(windows))
+		for _, window := range windows {
+			uptime, err := badger.FetchUptime(c.Params.ByName("chall_name"), window, now, false)
+			if err != nil {
+				logger.Warnf("%v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went to bad when fetching test results."})
+				return
+			}
+			uptimes = append(uptimes, uptime)
+		}
+		serve_json(c, gin.H{"name": c.Params.ByName("chall_name"), "windows": uptimes}, time.Time{})
+	})
+
+	// periods of states of a challenge, to know when it was down
+	server.GET("/api/challenges/:chall_name/timeline", func(c *gin.Context) {
+		window := c.DefaultQuery("window", "24h")
+		if _, err := badge.ParseWindow(window); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		uptime, err := badger.FetchUptime(c.Params.ByName("chall_name"), window, time.Now(), true)
+		if err != nil {
+			logger.Warnf("%v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went to bad when fetching test results."})
+			return
+		}
+		serve_json(c, uptime, time.Time{})
+	})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestApi_ServeJSONRevalidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := gin.New()
+	server.GET("/json", func(c *gin.Context) {
+		serve_json(c, map[string]string{"status": "success"}, time.Time{})
+	})
+	get := func(if_none_match string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/json", nil)
+		if if_none_match != "" {
+			req.Header.Set("If-None-Match", if_none_match)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w
+	}
+	etag := get("").Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected ETag header")
+	}
+
+	tests := []struct {
+		name          string
+		if_none_match string
+		status        int
+	}{
+		{"exact", etag, http.StatusNotModified},
+		{"any", "*", http.StatusNotModified},
+		{"list", `"0123", ` + etag, http.StatusNotModified},
+		{"list-without-space", etag + `,"0123"`, http.StatusNotModified},
+		{"weak", "W/" + etag, http.StatusNotModified},
+		{"weak-in-list", `"0123", W/` + etag, http.StatusNotModified},
+		{"other", `"0123", W/"4567"`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := get(tt.if_none_match); w.Code != tt.status {
+				t.Errorf("If-None-Match %s: expected status %d, got %d", tt.if_none_match, tt.status, w.Code)
+			}
+		})
+	}
+}
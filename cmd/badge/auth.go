@@ -0,0 +1,35 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Reject requests without the admin token, given either as `Authorization: Bearer <token>`
+// or as the password of Basic authentication, so that browsers can prompt for it.
+// If no token is configured, the endpoints are disabled.
+func require_token(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin endpoints are disabled. Set --admin-token to enable them."})
+			return
+		}
+		if !authorized(c, token) {
+			c.Header("WWW-Authenticate", `Basic realm="tsgctf-checker", charset="UTF-8"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token."})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Check the admin token of a request in constant time.
+func authorized(c *gin.Context, token string) bool {
+	given := c.GetHeader("Authorization")
+	if _, password, ok := c.Request.BasicAuth(); ok {
+		given = "Bearer " + password
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte("Bearer "+token)) == 1
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tsg-ut/tsgctf-checker/badge"
+	"go.uber.org/zap"
+)
+
+// Forbid caches to store the response, including rejections of authentication.
+func no_store(c *gin.Context) {
+	c.Header("Cache-Control", "private, no-store")
+}
+
+// Register the HTML dashboard and pages of failure logs.
+// Logs may contain flags printed by solvers, so they are shown only with the admin token and never cached.
+func register_dashboard(server *gin.Engine, logger *zap.SugaredLogger, badger *badge.Badger, token string) {
+	server.GET("/", func(c *gin.Context) {
+		c.Redirect(http.StatusFound, "/dashboard")
+	})
+
+	server.GET("/dashboard", func(c *gin.Context) {
+		dashboard, err := badger.FetchDashboard(time.Now())
+		if err != nil {
+			logger.Warnf("%v", err)
+			c.String(http.StatusInternalServerError, "Something went to bad when fetching test results.")
+			return
+		}
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		if err := dashboard.Render(c.Writer); err != nil {
+			logger.Warnf("%v", err)
+			c.String(http.StatusInternalServerError, "Failed to render the dashboard.")
+		}
+	})
+
+	server.GET("/dashboard/log/:chall_name/:run_id/:attempt", no_store, require_token(token), func(c *gin.Context) {
+		attempt, err := strconv.ParseUint(c.Params.ByName("attempt"), 10, 32)
+		if err != nil {
+			c.String(http.StatusBadRequest, "Invalid attempt.")
+			return
+		}
+		page, err := badger.FetchLogPage(c.Params.ByName("chall_name"), c.Params.ByName("run_id"), uint(attempt))
+		if errors.Is(err, sql.ErrNoRows) {
+			c.String(http.StatusNotFound, "Log not found.")
+			return
+		}
+		if err != nil {
+			logger.Warnf("%v", err)
+			c.String(http.StatusInternalServerError, "Something went to bad when fetching the log.")
+			return
+		}
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		if err := page.Render(c.Writer); err != nil {
+			logger.Warnf("%v", err)
+			c.String(http.StatusInternalServerError, "Failed to render the log.")
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tsg-ut/tsgctf-checker/badge"
+	"github.com/tsg-ut/tsgctf-checker/checker"
+	"go.uber.org/zap"
+)
+
+func create_server(t *testing.T, token string) *gin.Engine {
+	t.Helper()
+	db, err := checker.ConnectSQLite(filepath.Join(t.TempDir(), "checker.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := checker.NewSQLStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	logger := zap.NewNop().Sugar()
+	if err := store.Migrate(logger); err != nil {
+		t.Fatal(err)
+	}
+	res := checker.TestResultMessage{Result: checker.ResultSuccess, Stdout: "TSGCTF{flag}", Timestamp: time.Now()}
+	if err := store.RecordResult(checker.Challenge{Name: "pwn"}, res, "run", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	server := gin.New()
+	badger := badge.NewBadger(store)
+	register_dashboard(server, logger, badger, token)
+	register_maintenance(server, logger, badger, token)
+	return server
+}
+
+func TestDashboard_LogRequiresToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string // token of the server
+		auth   func(req *http.Request)
+		status int
+	}{
+		{"disabled", "", func(req *http.Request) { req.Header.Set("Authorization", "Bearer ") }, http.StatusForbidden},
+		{"no-token", "secret", func(req *http.Request) {}, http.StatusUnauthorized},
+		{"wrong-token", "secret", func(req *http.Request) { req.Header.Set("Authorization", "Bearer wrong") }, http.StatusUnauthorized},
+		{"bearer", "secret", func(req *http.Request) { req.Header.Set("Authorization", "Bearer secret") }, http.StatusOK},
+		{"basic", "secret", func(req *http.Request) { req.SetBasicAuth("admin", "secret") }, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := create_server(t, tt.token)
+			req := httptest.NewRequest(http.MethodGet, "/dashboard/log/pwn/run/1", nil)
+			tt.auth(req)
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if cache := w.Header().Get("Cache-Control"); cache != "private, no-store" {
+				t.Errorf("Unexpected Cache-Control: %q", cache)
+			}
+			if leaked := strings.Contains(w.Body.String(), "TSGCTF{flag}"); leaked != (tt.status == http.StatusOK) {
+				t.Errorf("Log shown = %v with status %d", leaked, w.Code)
+			}
+			if tt.status == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("Expected WWW-Authenticate header for browsers")
+			}
+		})
+	}
+}
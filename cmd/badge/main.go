@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/tsg-ut/tsgctf-checker/badge"
@@ -13,11 +14,47 @@ import (
 	"go.uber.org/zap"
 )
 
+var (
+	conffile     = flag.String("config", "", "Configuration file of the checker. Only the database settings (db_*) are used. (optional)")
+	port         = flag.Int("port", 8080, "Port number this badge server listens to. (can be specified also by $BADGEPORT envvar.)")
+	auto_migrate = flag.Bool("auto-migrate", false, "Apply pending database migrations at startup.")
+	redirect     = flag.Bool("redirect", false, "Redirect to img.shields.io instead of rendering badges locally.")
+	ctf_start    = flag.String("ctf-start", "", "Start time of the CTF in RFC3339, used by \"ctf\" window of uptime. (default to the first result)")
+	ctf_end      = flag.String("ctf-end", "", "End time of the CTF in RFC3339, used by \"ctf\" window of uptime.")
+	max_gap      = flag.Float64("max-gap", badge.DefaultMaxGap.Seconds(), "Seconds for which a result is regarded as the state of a challenge in uptime.")
+	style        = flag.String("style", "flat", "Default style of badges, \"flat\" or \"flat-square\". (can be overridden by ?style= query.)")
+	admin_token  = flag.String("admin-token", "", "Token to read logs of tests and edit maintenance windows. (can be specified also by $BADGE_ADMIN_TOKEN envvar.)")
+)
+
+const cacheControl = "max-age=60, public, immutable, must-revalidate"
+
+// Respond with the badge, either rendered as SVG or redirected to img.shields.io.
+func serve_badge(c *gin.Context, b badge.Badge, default_style badge.Style) {
+	c.Header("Cache-Control", cacheControl)
+	if *redirect {
+		c.Redirect(http.StatusFound, b.ShieldsUrl())
+		return
+	}
+
+	badge_style := default_style
+	if query := c.Query("style"); query != "" {
+		var err error
+		if badge_style, err = badge.ParseStyle(query); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	svg, err := b.SVG(badge_style)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Data(http.StatusOK, "image/svg+xml; charset=utf-8", svg)
+}
+
 func get_port() int {
 	// priority is command-line > ENVVAR.
 	var port_num int = 0
-	port := flag.Int("port", 8080, "Port number this badge server listens to. (can be specified also by $BADGEPORT envvar.)")
-	flag.Parse()
 
 	port_num = *port
 	port_str := os.Getenv("BADGE_PORT")
@@ -38,6 +75,23 @@ func get_port() int {
 	return port_num
 }
 
+// Create the configuration of uptime from command-line options.
+func create_uptime_conf() (badge.UptimeConfig, error) {
+	conf := badge.UptimeConfig{MaxGap: time.Duration(*max_gap * float64(time.Second))}
+	var err error
+	if *ctf_start != "" {
+		if conf.CTFStart, err = time.Parse(time.RFC3339, *ctf_start); err != nil {
+			return conf, err
+		}
+	}
+	if *ctf_end != "" {
+		if conf.CTFEnd, err = time.Parse(time.RFC3339, *ctf_end); err != nil {
+			return conf, err
+		}
+	}
+	return conf, nil
+}
+
 func main() {
 	// force running in production mode
 	gin.SetMode(gin.ReleaseMode)
@@ -49,12 +103,55 @@ func main() {
 	defer slogger.Sync()
 	logger := slogger.Sugar()
 
+	flag.Parse()
+
 	// get Badger
-	db, err := checker.Connect(os.Getenv("DBUSER"), os.Getenv("DBPASS"), os.Getenv("DBHOST"), os.Getenv("DBNAME"))
+	var conf checker.CheckerConfig
+	if *conffile != "" {
+		var err error
+		if conf, err = checker.ReadConf(*conffile); err != nil {
+			logger.Fatal(err)
+		}
+	}
+	params, err := checker.ResolveDbParams(conf)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	store, err := checker.OpenStore(params)
 	if err != nil {
 		logger.Fatal(err)
 	}
-	badger := badge.NewBadger(db)
+	defer store.Close()
+	switch flag.Arg(0) {
+	case "":
+		if *auto_migrate {
+			err = store.Migrate(logger)
+		} else {
+			err = store.VerifySchema()
+		}
+		if err != nil {
+			logger.Fatal(err)
+		}
+	case "migrate":
+		// apply pending migrations and exit
+		if err := store.Migrate(logger); err != nil {
+			logger.Fatal(err)
+		}
+		logger.Infof("Database schema is at version %d.", store.LatestSchemaVersion())
+		return
+	default:
+		logger.Fatalf("Unknown subcommand: %s", flag.Arg(0))
+	}
+	badger := badge.NewBadger(store)
+	default_style, err := badge.ParseStyle(*style)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	uptime_conf, err := create_uptime_conf()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	badger.SetUptimeConfig(uptime_conf)
 
 	// init server
 	server := gin.Default()
@@ -64,10 +161,24 @@ func main() {
 		c.String(http.StatusOK, "pong")
 	})
 
+	// JSON API
+	register_api(server, logger, badger)
+
+	// token of logs and maintenance windows
+	token := *admin_token
+	if token == "" {
+		token = os.Getenv("BADGE_ADMIN_TOKEN")
+	}
+
+	// HTML dashboard
+	register_dashboard(server, logger, badger, token)
+
+	// maintenance windows
+	register_maintenance(server, logger, badger, token)
+
 	// pizza
 	server.GET("/badge/pizza", func(c *gin.Context) {
-		c.Header("Cache-Control", "max-age=60, public, immutable, must-revalidate")
-		c.Redirect(http.StatusFound, "https://img.shields.io/badge/pizza-I_want_it-green")
+		serve_badge(c, badge.Badge{Label: "pizza", Message: "I want it", Color: "green"}, default_style)
 		return
 	})
 
@@ -75,22 +186,37 @@ func main() {
 	server.GET("/badge/:chall_name", func(c *gin.Context) {
 		chall_name := c.Params.ByName("chall_name")
 
-		badge_url, err := badger.GetBadge(chall_name)
+		b, err := badger.FetchBadge(chall_name, time.Now())
 		if err != nil {
 			logger.Warnf("%v", err)
 			c.String(http.StatusInternalServerError, "Something went to bad when fetching test result.")
 			return
 		}
 
-		c.Header("Cache-Control", "max-age=60, public, immutable, must-revalidate")
-		c.Redirect(http.StatusFound, badge_url)
+		serve_badge(c, b, default_style)
 		return
 	})
 
+	// uptime badge EP
+	server.GET("/badge/:chall_name/uptime/:window", func(c *gin.Context) {
+		window := c.Params.ByName("window")
+		if _, err := badge.ParseWindow(window); err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		uptime, err := badger.FetchUptime(c.Params.ByName("chall_name"), window, time.Now(), false)
+		if err != nil {
+			logger.Warnf("%v", err)
+			c.String(http.StatusInternalServerError, "Something went to bad when fetching test result.")
+			return
+		}
+
+		serve_badge(c, uptime.Badge(), default_style)
+	})
+
 	// default error badge
 	server.GET("/badge/error", func(c *gin.Context) {
-		c.Header("Cache-Control", "max-age=60, public, immutable, must-revalidate")
-		c.Redirect(http.StatusFound, "https://img.shields.io/badge/error-status_fetching_fails-red")
+		serve_badge(c, badge.Badge{Label: "error", Message: "status fetching fails", Color: "red"}, default_style)
 	})
 
 	// run server
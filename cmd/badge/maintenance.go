@@ -0,0 +1,67 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tsg-ut/tsgctf-checker/badge"
+	"github.com/tsg-ut/tsgctf-checker/checker"
+	"go.uber.org/zap"
+)
+
+// Register endpoints of maintenance windows. Windows are listed publicly, and edited with the admin token.
+func register_maintenance(server *gin.Engine, logger *zap.SugaredLogger, badger *badge.Badger, token string) {
+	server.GET("/api/maintenance", func(c *gin.Context) {
+		list, err := badger.FetchMaintenance(time.Now())
+		if err != nil {
+			logger.Warnf("%v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went to bad when fetching maintenance windows."})
+			return
+		}
+		serve_json(c, list, time.Time{})
+	})
+
+	server.POST("/api/maintenance", require_token(token), func(c *gin.Context) {
+		var window checker.MaintenanceWindow
+		if err := c.ShouldBindJSON(&window); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		window, err := badger.AddMaintenance(window, time.Now())
+		if errors.Is(err, badge.ErrInvalidMaintenance) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			logger.Warnf("%v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went to bad when recording the maintenance window."})
+			return
+		}
+		logger.Infow("Maintenance window added", "id", window.ID, "challenge", window.Challenge, "genre", window.Genre, "end", window.End)
+		c.JSON(http.StatusCreated, window)
+	})
+
+	server.DELETE("/api/maintenance/:id", require_token(token), func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Params.ByName("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id."})
+			return
+		}
+		err = badger.DeleteMaintenance(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Maintenance window not found."})
+			return
+		}
+		if err != nil {
+			logger.Warnf("%v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Something went to bad when deleting the maintenance window."})
+			return
+		}
+		logger.Infow("Maintenance window deleted", "id", id)
+		c.Status(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tsg-ut/tsgctf-checker/checker"
+)
+
+func TestMaintenance_Post(t *testing.T) {
+	server := create_server(t, "secret")
+	end := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"valid", `{"challenge": "pwn", "end": "` + end + `"}`, http.StatusCreated},
+		{"no-target", `{"end": "` + end + `"}`, http.StatusBadRequest},
+		{"no-end", `{"challenge": "pwn"}`, http.StatusBadRequest},
+		{"broken", `{"challenge": `, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/maintenance", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer secret")
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.status != http.StatusCreated {
+				return
+			}
+			var window checker.MaintenanceWindow
+			if err := json.Unmarshal(w.Body.Bytes(), &window); err != nil {
+				t.Fatal(err)
+			}
+			if window.ID == 0 || window.Start.IsZero() {
+				t.Errorf("Window should start now and have its ID: %+v", window)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/tsg-ut/tsgctf-checker/checker"
+	"go.uber.org/zap"
+)
+
+// Calculate the waiting time until the next test cycle.
+func next_interval(conf checker.CheckerConfig) time.Duration {
+	interval := conf.Interval
+	if interval <= 0 {
+		interval = checker.DefaultInterval
+	}
+	if conf.Jitter > 0 {
+		interval += rand.Float64() * conf.Jitter
+	}
+	return time.Duration(interval * float64(time.Second))
+}
+
+// Run test cycles repeatedly until ctx is cancelled.
+// The config file and the targets file are reloaded before every cycle,
+// while the result store is shared among all cycles.
+// If ctx is cancelled during a cycle, running solver containers are cleaned up
+// by executers and this function returns after the cycle finishes.
+func run_daemon(ctx context.Context, logger *zap.SugaredLogger, conf checker.CheckerConfig, store checker.ResultStore) {
+	for cycle := 1; ; cycle++ {
+		logger.Infof("Starting test cycle #%d.", cycle)
+		cycle_lock.Lock()
+		report, err := checker.RunRecordTests(ctx, logger, conf, store)
+		cycle_lock.Unlock()
+		if err != nil {
+			logger.Errorw("Test cycle failed", "cycle", cycle, "error", err)
+		}
+		write_report(logger, report)
+		if ctx.Err() != nil {
+			logger.Info("Checker daemon terminated.")
+			return
+		}
+
+		wait := next_interval(conf)
+		logger.Infof("Test cycle #%d finished. Next cycle starts in %v.", cycle, wait.Round(time.Second))
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			logger.Info("Checker daemon terminated.")
+			return
+		case <-timer.C:
+		}
+
+		// reload configuration
+		new_conf, err := create_conf()
+		if err != nil {
+			logger.Errorw("Failed to reload configuration. Keep using the previous one.", "error", err)
+			continue
+		}
+		conf = new_conf
+	}
+}
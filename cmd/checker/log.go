@@ -0,0 +1,15 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/tsg-ut/tsgctf-checker/checker"
+)
+
+// Print stdout and stderr of a test recorded in the store.
+func print_log(w io.Writer, log checker.DbLog) {
+	fmt.Fprintf(w, "Challenge: %s\nTest cycle: %s\nAttempt: %d\nTimestamp: %s\n", log.Name, log.RunID, log.Attempt, log.Timestamp.UTC().Format("2006-01-02 15:04:05 UTC"))
+	fmt.Fprintf(w, "\n===== STDOUT =====\n%s\n", log.Stdout)
+	fmt.Fprintf(w, "\n===== STDERR =====\n%s\n", log.Stderr)
+}
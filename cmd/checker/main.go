@@ -1,31 +1,51 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
-	"github.com/jmoiron/sqlx"
 	"github.com/tsg-ut/tsgctf-checker/checker"
 	"go.uber.org/zap"
 )
 
-func create_conf(logger *zap.SugaredLogger) (checker.CheckerConfig, error) {
-	// command-line option overrides configuration of config file.
-	conffile := flag.String("config", "config.json", "Configuration file path.")
-	retries := flag.Uint("retry", 0, "Number of retries when a test fails.")
-	challs_dir := flag.String("challs", "challs", "Challenges directory.")
-	parallel := flag.Uint("parallel", 1, "Number of parallel tests.")
-	skip_non_exist := flag.Bool("skip-non-exist", false, "Skip challenges who don't have info.json.")
-	extra_docker_arg := flag.String("extra-docker-arg", "", "Extra docker arguments passed to \"run\" command.")
-	targets_file := flag.String("targets", "targets.json", "Targets file path.")
-	notify_slack := flag.Bool("notify-slack", false, "Notify slack when a test fails.")
-	dryrun := flag.Bool("dryrun", false, "Dryrun mode. (Don't update database.)")
-	target_tests := flag.String("t", "", "Target tests to run.")
-	verbose := flag.Bool("verbose", false, "Verbose logging mode.")
-	flag.Parse()
+// command-line option overrides configuration of config file.
+var (
+	conffile         = flag.String("config", "config.json", "Configuration file path.")
+	retries          = flag.Uint("retry", 0, "Number of retries when a test fails.")
+	retry_backoff    = flag.Float64("retry-backoff", checker.DefaultRetryBackoff, "Backoff in seconds before the first retry. (doubled on each retry)")
+	challs_dir       = flag.String("challs", "challs", "Challenges directory.")
+	parallel         = flag.Uint("parallel", 1, "Number of parallel tests.")
+	build_parallel   = flag.Uint("build-parallel", 1, "Number of parallel builds of solver images.")
+	skip_non_exist   = flag.Bool("skip-non-exist", false, "Skip challenges who don't have info.json.")
+	extra_docker_arg = flag.String("extra-docker-arg", "", "Extra docker arguments passed to \"run\" command.")
+	targets_file     = flag.String("targets", "targets.json", "Targets file path.")
+	notify_slack     = flag.Bool("notify-slack", false, "Notify slack when a test fails.")
+	notify           = flag.Bool("notify", false, "Notify the notifiers in config file when a test fails.")
+	dryrun           = flag.Bool("dryrun", false, "Dryrun mode. (Don't update database.)")
+	target_tests     = flag.String("t", "", "Target tests to run.")
+	verbose          = flag.Bool("verbose", false, "Verbose logging mode.")
+	daemon           = flag.Bool("daemon", false, "Daemon mode. (Run tests repeatedly until SIGTERM/SIGINT.)")
+	interval         = flag.Float64("interval", checker.DefaultInterval, "Interval in seconds between test cycles in daemon mode.")
+	jitter           = flag.Float64("jitter", 0, "Maximum random delay in seconds added to the interval in daemon mode.")
+	auto_migrate     = flag.Bool("auto-migrate", false, "Apply pending database migrations at startup.")
+	report_file      = flag.String("report", "", "Write the report of the test cycle to this file.")
+	report_format    = flag.String("report-format", "", "Format of the report, \"json\" or \"junit\". (Inferred from the extension of the file if empty.)")
+	fail_on          = flag.String("fail-on", "", "Exit with non-zero code when challenges are unsolvable: \"never\", \"any\" or \"fraction\".")
+	fail_genres      = flag.String("fail-genres", "", "Comma separated list of genres considered by --fail-on.")
+	fail_challs      = flag.String("fail-challenges", "", "Comma separated list of challenges considered by --fail-on.")
+	fail_fraction    = flag.Float64("fail-fraction", 0, "Maximum fraction of unsolvable challenges with --fail-on=fraction.")
+	slack_listen     = flag.String("slack-listen", "", "Address to serve the endpoint of Slack slash command and buttons, eg: \":8081\". (with --daemon or \"serve\" subcommand)")
+)
 
+// Read the config file and apply command-line options.
+// This can be called multiple times to reload the config file.
+func create_conf() (checker.CheckerConfig, error) {
 	conf, err := checker.ReadConf(*conffile)
 	if err != nil {
 		return conf, err
@@ -33,14 +53,21 @@ func create_conf(logger *zap.SugaredLogger) (checker.CheckerConfig, error) {
 
 	// Override with command-line options
 	unknown_flags := make([]string, 0)
+	conf_errors := make([]string, 0)
 	flag.Visit(func(f *flag.Flag) {
 		switch f.Name {
-		case "retries":
+		case "retry":
 			conf.Retries = *retries
 			break
+		case "retry-backoff":
+			conf.RetryBackoff = *retry_backoff
+			break
 		case "parallel":
 			conf.ParallelNum = *parallel
 			break
+		case "build-parallel":
+			conf.BuildParallelNum = *build_parallel
+			break
 		case "challs":
 			conf.ChallsDir = *challs_dir
 			break
@@ -52,10 +79,16 @@ func create_conf(logger *zap.SugaredLogger) (checker.CheckerConfig, error) {
 			break
 		case "notify-slack":
 			if (conf.SlackToken == "" || conf.SlackChannel == "") && *notify_slack {
-				logger.Fatal("Slack notification is enabled, but slack_token or slack_channel is not set in config.")
+				conf_errors = append(conf_errors, "Slack notification is enabled, but slack_token or slack_channel is not set in config.")
 			}
 			conf.NotifySlack = *notify_slack
 			break
+		case "notify":
+			if len(conf.Notifiers) == 0 && *notify {
+				conf_errors = append(conf_errors, "Notification is enabled, but no notifiers are set in config.")
+			}
+			conf.Notify = *notify
+			break
 		case "extra-docker-arg":
 			conf.ExtraDockerArg = *extra_docker_arg
 			break
@@ -68,7 +101,28 @@ func create_conf(logger *zap.SugaredLogger) (checker.CheckerConfig, error) {
 		case "t":
 			conf.TargetTests = *target_tests
 			break
-		case "config":
+		case "daemon":
+			conf.Daemon = *daemon
+			break
+		case "interval":
+			conf.Interval = *interval
+			break
+		case "jitter":
+			conf.Jitter = *jitter
+			break
+		case "fail-on":
+			conf.FailOn = *fail_on
+			break
+		case "fail-genres":
+			conf.FailGenres = split_list(*fail_genres)
+			break
+		case "fail-challenges":
+			conf.FailChalls = split_list(*fail_challs)
+			break
+		case "fail-fraction":
+			conf.FailFraction = *fail_fraction
+			break
+		case "config", "auto-migrate", "report", "report-format", "slack-listen":
 			break
 		default:
 			unknown_flags = append(unknown_flags, f.Name)
@@ -78,33 +132,191 @@ func create_conf(logger *zap.SugaredLogger) (checker.CheckerConfig, error) {
 	if len(unknown_flags) > 0 {
 		return conf, fmt.Errorf("Unknown flags: %s", strings.Join(unknown_flags, ", "))
 	}
+	if len(conf_errors) > 0 {
+		return conf, errors.New(strings.Join(conf_errors, " "))
+	}
+	if err := checker.ValidateExtraDockerArg(conf.ExtraDockerArg); err != nil {
+		return conf, err
+	}
 
 	return conf, nil
 }
 
+// Split a comma separated list, ignoring empty elements.
+func split_list(list string) []string {
+	elems := make([]string, 0)
+	for _, elem := range strings.Split(list, ",") {
+		if elem = strings.TrimSpace(elem); elem != "" {
+			elems = append(elems, elem)
+		}
+	}
+	return elems
+}
+
+// Open the result store specified by the configuration and environment variables.
+func open_store(conf checker.CheckerConfig) (*checker.SQLStore, error) {
+	params, err := checker.ResolveDbParams(conf)
+	if err != nil {
+		return nil, err
+	}
+	return checker.OpenStore(params)
+}
+
+// Write the report of a test cycle if --report is given.
+func write_report(logger *zap.SugaredLogger, report *checker.Report) {
+	if *report_file == "" || report == nil {
+		return
+	}
+	if err := report.WriteFile(*report_file, *report_format); err != nil {
+		logger.Errorw("Failed to write report", "file", *report_file, "error", err)
+		return
+	}
+	logger.Infof("Report written to %s.", *report_file)
+}
+
 func main() {
+	// exit after all deferred functions are run
+	exit_code := checker.ExitOK
+	defer func() {
+		if exit_code != checker.ExitOK {
+			os.Exit(exit_code)
+		}
+	}()
+
 	level := zap.NewAtomicLevel()
 	level.SetLevel(zap.DebugLevel)
 	slogger, _ := zap.NewDevelopment()
 	defer slogger.Sync()
 	logger := slogger.Sugar()
 
-	conf, err := create_conf(logger)
+	flag.Parse()
+	conf, err := create_conf()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	policy, err := checker.NewExitPolicy(conf)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	serve := false
+	switch flag.Arg(0) {
+	case "":
+	case "serve":
+		// only serve the endpoint of Slack, running tests on requests
+		serve = true
+		if *slack_listen == "" {
+			logger.Fatal("\"serve\" subcommand requires --slack-listen.")
+		}
+	case "migrate":
+		// apply pending migrations and exit
+		store, err := open_store(conf)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer store.Close()
+		if err := store.Migrate(logger); err != nil {
+			logger.Fatal(err)
+		}
+		logger.Infof("Database schema is at version %d.", store.LatestSchemaVersion())
+		return
+	case "log":
+		// print the log of a test: `log <chall> [run_id]`. The last failed test by default.
+		if flag.NArg() < 2 || flag.NArg() > 3 {
+			logger.Fatal("Usage: checker [options] log <challenge> [run_id]")
+		}
+		store, err := open_store(conf)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer store.Close()
+		log, err := checker.FindLog(store, flag.Arg(1), flag.Arg(2))
+		if err != nil {
+			logger.Fatal(err)
+		}
+		print_log(os.Stdout, log)
+		return
+	default:
+		logger.Fatalf("Unknown subcommand: %s", flag.Arg(0))
+	}
+
+	// remove solver containers left behind by crashed checker processes
+	docker, err := checker.NewDockerClient()
 	if err != nil {
 		logger.Fatal(err)
 	}
+	if err := checker.SweepOrphanedContainers(logger, docker); err != nil {
+		logger.Warnw("Failed to sweep orphaned containers", "error", err)
+	}
+	docker.Close()
 
-	var db *sqlx.DB
+	var store checker.ResultStore
 	if conf.Dryrun == false {
-		db, err = checker.Connect(os.Getenv("DBUSER"), os.Getenv("DBPASS"), os.Getenv("DBHOST"), os.Getenv("DBNAME"))
+		sql_store, err := open_store(conf)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer sql_store.Close()
+		if *auto_migrate {
+			err = sql_store.Migrate(logger)
+		} else {
+			err = sql_store.VerifySchema()
+		}
 		if err != nil {
 			logger.Fatal(err)
 		}
+		store = sql_store
 	} else {
-		db = nil
+		store = nil
 	}
 
-	if err := checker.RunRecordTests(logger, conf, db); err != nil {
+	// the test cycle is cancelled by SIGTERM or SIGINT.
+	// running solver containers are cleaned up before exiting.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		logger.Info("Checker process interrupted, cleaning up...")
+		// the second signal kills the process immediately
+		stop()
+	}()
+
+	if serve {
+		if err := serve_slack(ctx, logger, conf, store); err != nil {
+			logger.Fatal(err)
+		}
+		return
+	}
+
+	if conf.Daemon {
+		slack_done := make(chan struct{})
+		if *slack_listen != "" {
+			go func() {
+				defer close(slack_done)
+				if err := serve_slack(ctx, logger, conf, store); err != nil {
+					logger.Errorw("Failed to serve the endpoint of Slack", "error", err)
+				}
+			}()
+		} else {
+			close(slack_done)
+		}
+		run_daemon(ctx, logger, conf, store)
+		<-slack_done
+		return
+	}
+	if *slack_listen != "" {
+		logger.Fatal("--slack-listen requires --daemon or \"serve\" subcommand.")
+	}
+
+	report, err := checker.RunRecordTests(ctx, logger, conf, store)
+	if err != nil {
 		logger.Fatal(err)
 	}
+	write_report(logger, report)
+
+	code, reason := policy.ExitCode(report)
+	if code != checker.ExitOK {
+		logger.Errorw("Checker failed by the exit policy", "fail_on", policy.FailOn, "reason", reason, "code", code)
+		exit_code = code
+	}
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tsg-ut/tsgctf-checker/checker"
+	"go.uber.org/zap"
+)
+
+// Held while a test cycle runs, so that re-runs from Slack do not run concurrently with test cycles of the daemon.
+var cycle_lock sync.Mutex
+
+// Run a test of a single challenge with the latest configuration.
+func rerun_challenge(logger *zap.SugaredLogger, store checker.ResultStore) checker.RerunFunc {
+	return func(ctx context.Context, chall_name string) (*checker.Report, error) {
+		conf, err := create_conf()
+		if err != nil {
+			return nil, err
+		}
+		conf.TargetTests = chall_name
+
+		cycle_lock.Lock()
+		defer cycle_lock.Unlock()
+		report, err := checker.RunRecordTests(ctx, logger, conf, store)
+		write_report(logger, report)
+		return report, err
+	}
+}
+
+// Serve the endpoint of the Slack slash command and the "Re-run" button at `/slack` until ctx is cancelled.
+// It returns after the running re-run is cleaned up.
+func serve_slack(ctx context.Context, logger *zap.SugaredLogger, conf checker.CheckerConfig, store checker.ResultStore) error {
+	if conf.SlackToken == "" || conf.SlackSecret == "" {
+		return fmt.Errorf("Slack endpoint requires slack_token and slack_signing_secret in config.")
+	}
+	handler := checker.NewSlackCommandHandler(logger, conf.SlackSecret, conf.SlackToken, rerun_challenge(logger, store))
+	done := make(chan struct{})
+	go func() {
+		handler.Run(ctx)
+		close(done)
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle("/slack", handler)
+	server := &http.Server{Addr: *slack_listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdown_ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown_ctx)
+	}()
+
+	logger.Infof("Slack endpoint running on %s/slack.", *slack_listen)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-done
+	return nil
+}
@@ -1,3 +1,5 @@
+-- Schema created by the oldest `init.sql`.
+-- Tests upgrade it by `checker.Migrate()` to check migrations of existing databases.
 create table if not exists `test_result`
 (
   `name`        varchar(255)      not null,